@@ -5,6 +5,50 @@ import (
 	"fmt"
 )
 
+// addColumnIfNotExists adds a column to a table created by an older version of
+// CreateTables, since CREATE TABLE IF NOT EXISTS leaves existing tables alone
+func addColumnIfNotExists(db *sql.DB, table, column, definition string) error {
+	var count int
+	query := "SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?"
+	if err := db.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// migrateReactionStates turns the like/dislike state of a reaction table
+// created by an older version of CreateTables into named reactions, so a user
+// can give several reactions to the same item
+func migrateReactionStates(db *sql.DB, table, itemColumn string) error {
+	var count int
+	query := "SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'state'"
+	if err := db.QueryRow(query, table).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return nil
+	}
+
+	if err := addColumnIfNotExists(db, table, "reaction", "VARCHAR(32) NOT NULL DEFAULT 'like'"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf("UPDATE %s SET reaction = IF(state = 1, 'like', 'dislike')", table)); err != nil {
+		return err
+	}
+	_, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (user_id, %s, reaction),
+    ADD INDEX (%s, reaction),
+    ALTER reaction DROP DEFAULT,
+    DROP COLUMN state`, table, itemColumn, itemColumn))
+	return err
+}
+
 func CreateTables(db *sql.DB) error {
 	createCategoriesTableSQL := `
   CREATE TABLE IF NOT EXISTS CATEGORIES (
@@ -50,9 +94,10 @@ func CreateTables(db *sql.DB) error {
   CREATE TABLE IF NOT EXISTS THREAD_REACTIONS (
     user_id INT NOT NULL,
     thread_id INT NOT NULL,
-    state TINYINT NOT NULL,
+    reaction VARCHAR(32) NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    PRIMARY KEY (user_id, thread_id),
+    PRIMARY KEY (user_id, thread_id, reaction),
+    INDEX (thread_id, reaction),
     FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
     FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE
 );`
@@ -61,13 +106,24 @@ func CreateTables(db *sql.DB) error {
   CREATE TABLE IF NOT EXISTS COMMENT_REACTIONS (
     user_id INT NOT NULL,
     comment_id BIGINT UNSIGNED NOT NULL,
-    state TINYINT NOT NULL,
+    reaction VARCHAR(32) NOT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    PRIMARY KEY (user_id, comment_id),
+    PRIMARY KEY (user_id, comment_id, reaction),
+    INDEX (comment_id, reaction),
     FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
     FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE
 );`
 
+	// Reactions refer to types by name. Disabled types are hidden but their
+	// reactions are kept.
+	createReactionTypesTableSQL := `
+  CREATE TABLE IF NOT EXISTS REACTION_TYPES (
+    name VARCHAR(32) NOT NULL PRIMARY KEY,
+    emoji VARCHAR(32) CHARACTER SET utf8mb4 NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);`
+
 	createReportsTableSQL := `
   CREATE TABLE IF NOT EXISTS REPORTS (
     id INT AUTO_INCREMENT PRIMARY KEY,
@@ -78,6 +134,193 @@ func CreateTables(db *sql.DB) error {
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
   );`
 
+	createDraftsTableSQL := `
+  CREATE TABLE IF NOT EXISTS DRAFTS (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    thread_id INT DEFAULT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    category_id INT DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES CATEGORIES(id) ON DELETE SET NULL
+);`
+
+	createAttachmentsTableSQL := `
+  CREATE TABLE IF NOT EXISTS ATTACHMENTS (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    storage_key VARCHAR(64) NOT NULL UNIQUE,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    uploader_id INT NOT NULL,
+    thread_id INT DEFAULT NULL,
+    comment_id BIGINT UNSIGNED DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (uploader_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE
+);`
+
+	createPollsTableSQL := `
+  CREATE TABLE IF NOT EXISTS POLLS (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    thread_id INT NOT NULL UNIQUE,
+    question VARCHAR(255) NOT NULL DEFAULT '',
+    multiple_choice BOOLEAN NOT NULL DEFAULT FALSE,
+    public_votes BOOLEAN NOT NULL DEFAULT FALSE,
+    closes_at TIMESTAMP NULL DEFAULT NULL,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE
+);`
+
+	createPollOptionsTableSQL := `
+  CREATE TABLE IF NOT EXISTS POLL_OPTIONS (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    poll_id INT NOT NULL,
+    position INT NOT NULL,
+    text VARCHAR(255) NOT NULL,
+    UNIQUE (poll_id, position),
+    FOREIGN KEY (poll_id) REFERENCES POLLS(id) ON DELETE CASCADE
+);`
+
+	// single_choice_poll_id is only set for votes on single choice polls, so the
+	// unique key allows one vote per user there and is ignored (NULL) otherwise
+	createPollVotesTableSQL := `
+  CREATE TABLE IF NOT EXISTS POLL_VOTES (
+    option_id INT NOT NULL,
+    user_id INT NOT NULL,
+    poll_id INT NOT NULL,
+    single_choice_poll_id INT DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (option_id, user_id),
+    UNIQUE (single_choice_poll_id, user_id),
+    FOREIGN KEY (option_id) REFERENCES POLL_OPTIONS(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (poll_id) REFERENCES POLLS(id) ON DELETE CASCADE
+);`
+
+	// subscribed is FALSE for users who unfollowed a thread, so that commenting
+	// again does not subscribe them automatically
+	createThreadSubscriptionsTableSQL := `
+  CREATE TABLE IF NOT EXISTS THREAD_SUBSCRIPTIONS (
+    user_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    subscribed BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, thread_id),
+    FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE
+);`
+
+	createNotificationsTableSQL := `
+  CREATE TABLE IF NOT EXISTS NOTIFICATIONS (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    type VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    thread_id INT DEFAULT NULL,
+    comment_id BIGINT UNSIGNED DEFAULT NULL,
+    details TEXT DEFAULT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (user_id, is_read, id),
+    FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE
+);`
+
+	createBookmarksTableSQL := `
+  CREATE TABLE IF NOT EXISTS BOOKMARKS (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    thread_id INT DEFAULT NULL,
+    comment_id BIGINT UNSIGNED DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, thread_id),
+    UNIQUE (user_id, comment_id),
+    FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE
+);`
+
+	// Slugs are compared byte for byte, the default collation would treat
+	// slugs differing only in accents or kana as the same
+	createThreadSlugsTableSQL := `
+  CREATE TABLE IF NOT EXISTS THREAD_SLUGS (
+    slug VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin PRIMARY KEY,
+    thread_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (thread_id),
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE
+);`
+
+	// A mention belongs to either a thread or a comment. Mentions removed by an
+	// edit become inactive rather than deleted, so their users are not
+	// notified again if they are added back.
+	createMentionsTableSQL := `
+  CREATE TABLE IF NOT EXISTS MENTIONS (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    thread_id INT DEFAULT NULL,
+    comment_id BIGINT UNSIGNED DEFAULT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (thread_id, user_id),
+    UNIQUE (comment_id, user_id),
+    FOREIGN KEY (user_id) REFERENCES USERS(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES THREADS(id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE
+);`
+
+	// quoted_author and quoted_text keep the passage as it was quoted, since the
+	// quoted comment may be edited or deleted later
+	createCommentQuotesTableSQL := `
+  CREATE TABLE IF NOT EXISTS COMMENT_QUOTES (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    comment_id BIGINT UNSIGNED NOT NULL,
+    quoted_comment_id BIGINT UNSIGNED DEFAULT NULL,
+    quoted_author VARCHAR(255) NOT NULL,
+    quoted_text TEXT NOT NULL,
+    range_start INT NOT NULL,
+    range_end INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (comment_id),
+    FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE,
+    FOREIGN KEY (quoted_comment_id) REFERENCES COMMENTS(id) ON DELETE SET NULL
+);`
+
+	// written_at is when the revised version was posted or last edited
+	createCommentRevisionsTableSQL := `
+  CREATE TABLE IF NOT EXISTS COMMENT_REVISIONS (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    comment_id BIGINT UNSIGNED NOT NULL,
+    content TEXT NOT NULL,
+    content_html TEXT NULL,
+    written_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (comment_id),
+    FOREIGN KEY (comment_id) REFERENCES COMMENTS(id) ON DELETE CASCADE
+);`
+
+	// Threads are not foreign keys since merged threads are deleted but their
+	// entries stay in the audit trail
+	createModerationLogTableSQL := `
+  CREATE TABLE IF NOT EXISTS MODERATION_LOG (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    moderator VARCHAR(255) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    thread_id INT NOT NULL,
+    target_thread_id INT DEFAULT NULL,
+    details TEXT NOT NULL,
+    reason VARCHAR(500) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX (thread_id),
+    INDEX (target_thread_id)
+);`
+
 	_, err := db.Exec(createCategoriesTableSQL)
 	if err != nil {
 		return fmt.Errorf("failed to create categories table: %v", err)
@@ -113,10 +356,193 @@ func CreateTables(db *sql.DB) error {
 		return fmt.Errorf("failed to create comment_reactions table: %v", err)
 	}
 
+	_, err = db.Exec(createReactionTypesTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create reaction types table: %v", err)
+	}
+
 	_, err = db.Exec(createReportsTableSQL)
 	if err != nil {
 		return fmt.Errorf("failed to create reports table: %v", err)
 	}
 
+	_, err = db.Exec(createDraftsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create drafts table: %v", err)
+	}
+
+	_, err = db.Exec(createAttachmentsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create attachments table: %v", err)
+	}
+
+	_, err = db.Exec(createPollsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create polls table: %v", err)
+	}
+
+	_, err = db.Exec(createPollOptionsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create poll_options table: %v", err)
+	}
+
+	_, err = db.Exec(createPollVotesTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create poll_votes table: %v", err)
+	}
+
+	_, err = db.Exec(createThreadSubscriptionsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create thread_subscriptions table: %v", err)
+	}
+
+	_, err = db.Exec(createNotificationsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create notifications table: %v", err)
+	}
+
+	_, err = db.Exec(createBookmarksTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create bookmarks table: %v", err)
+	}
+
+	_, err = db.Exec(createThreadSlugsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create thread slugs table: %v", err)
+	}
+
+	_, err = db.Exec(createModerationLogTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create moderation log table: %v", err)
+	}
+
+	_, err = db.Exec(createMentionsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create mentions table: %v", err)
+	}
+
+	_, err = db.Exec(createCommentQuotesTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create comment quotes table: %v", err)
+	}
+
+	_, err = db.Exec(createCommentRevisionsTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create comment revisions table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "THREADS", "publish_at", "TIMESTAMP NULL DEFAULT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add publish_at to threads table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "THREADS", "published", "BOOLEAN NOT NULL DEFAULT TRUE")
+	if err != nil {
+		return fmt.Errorf("failed to add published to threads table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "THREADS", "description_html", "TEXT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add description_html to threads table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "THREADS", "view_count", "INT NOT NULL DEFAULT 0")
+	if err != nil {
+		return fmt.Errorf("failed to add view_count to threads table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "COMMENTS", "content_html", "TEXT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add content_html to comments table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "THREADS", "slug", "VARCHAR(255) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add slug to threads table: %v", err)
+	}
+
+	// The foreign key and index are added in the same ALTER TABLE as the column
+	err = addColumnIfNotExists(db, "COMMENTS", "parent_id", "BIGINT UNSIGNED NULL DEFAULT NULL, ADD FOREIGN KEY (parent_id) REFERENCES COMMENTS(id) ON DELETE CASCADE")
+	if err != nil {
+		return fmt.Errorf("failed to add parent_id to comments table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "COMMENTS", "depth", "INT NOT NULL DEFAULT 0")
+	if err != nil {
+		return fmt.Errorf("failed to add depth to comments table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "COMMENTS", "path", "VARCHAR(255) CHARACTER SET ascii NULL DEFAULT NULL, ADD INDEX (thread_id, path)")
+	if err != nil {
+		return fmt.Errorf("failed to add path to comments table: %v", err)
+	}
+
+	// Comments from before replies existed are all top level
+	_, err = db.Exec("UPDATE COMMENTS SET path = LPAD(id, 20, '0') WHERE path IS NULL")
+	if err != nil {
+		return fmt.Errorf("failed to set path of comments: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "COMMENTS", "edited_at", "TIMESTAMP NULL DEFAULT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add edited_at to comments table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "COMMENTS", "edit_count", "INT NOT NULL DEFAULT 0")
+	if err != nil {
+		return fmt.Errorf("failed to add edit_count to comments table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "COMMENTS", "deleted_at", "TIMESTAMP NULL DEFAULT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add deleted_at to comments table: %v", err)
+	}
+
+	// "author" or "moderator" for tombstones of deleted comments
+	err = addColumnIfNotExists(db, "COMMENTS", "deleted_by", "VARCHAR(20) NULL DEFAULT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add deleted_by to comments table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "CATEGORIES", "qa_mode", "BOOLEAN NOT NULL DEFAULT FALSE")
+	if err != nil {
+		return fmt.Errorf("failed to add qa_mode to categories table: %v", err)
+	}
+
+	// NULL follows the category
+	err = addColumnIfNotExists(db, "THREADS", "qa_mode", "BOOLEAN NULL DEFAULT NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add qa_mode to threads table: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "THREADS", "accepted_comment_id", "BIGINT UNSIGNED NULL DEFAULT NULL, ADD FOREIGN KEY (accepted_comment_id) REFERENCES COMMENTS(id) ON DELETE SET NULL")
+	if err != nil {
+		return fmt.Errorf("failed to add accepted_comment_id to threads table: %v", err)
+	}
+
+	// Like and dislike keep the positions they had before other reactions existed
+	_, err = db.Exec(`
+  INSERT IGNORE INTO REACTION_TYPES (name, emoji, position) VALUES
+    ('like', '👍', 0), ('dislike', '👎', 1), ('heart', '❤️', 2),
+    ('laugh', '😂', 3), ('party', '🎉', 4), ('eyes', '👀', 5)`)
+	if err != nil {
+		return fmt.Errorf("failed to add default reaction types: %v", err)
+	}
+
+	err = migrateReactionStates(db, "THREAD_REACTIONS", "thread_id")
+	if err != nil {
+		return fmt.Errorf("failed to migrate thread reactions: %v", err)
+	}
+
+	err = migrateReactionStates(db, "COMMENT_REACTIONS", "comment_id")
+	if err != nil {
+		return fmt.Errorf("failed to migrate comment reactions: %v", err)
+	}
+
+	err = addColumnIfNotExists(db, "USERS", "role", "VARCHAR(20) NOT NULL DEFAULT 'user'")
+	if err != nil {
+		return fmt.Errorf("failed to add role to users table: %v", err)
+	}
+
 	return nil
 }
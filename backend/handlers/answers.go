@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type AnswerAccept struct {
+	CommentID int64 `json:"comment_id"`
+}
+
+type CategoryQAMode struct {
+	QAMode bool `json:"qa_mode"`
+}
+
+// qaModeColumn is whether a thread t in category c is in Q&A mode. Threads
+// follow their category unless Q&A mode was set on the thread itself.
+const qaModeColumn = "COALESCE(t.qa_mode, c.qa_mode, FALSE)"
+
+// solvedFilter reads ?solved=true or ?solved=false for thread lists and
+// returns the matching condition for threadSummaryQuery. Solved threads are
+// Q&A threads with an accepted answer, unsolved ones have none yet.
+func solvedFilter(r *http.Request) (string, error) {
+	solvedStr := r.URL.Query().Get("solved")
+	if solvedStr == "" {
+		return "", nil
+	}
+	solved, err := strconv.ParseBool(solvedStr)
+	if err != nil {
+		return "", err
+	}
+	if solved {
+		return " AND " + qaModeColumn + " AND t.accepted_comment_id IS NOT NULL", nil
+	}
+	return " AND " + qaModeColumn + " AND t.accepted_comment_id IS NULL", nil
+}
+
+// acceptedAnswer returns the ID of the accepted answer of a thread, or 0
+func acceptedAnswer(db *sql.DB, threadID int) (int, error) {
+	var accepted sql.NullInt64
+	err := db.QueryRow("SELECT accepted_comment_id FROM THREADS WHERE id = ?", threadID).Scan(&accepted)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return int(accepted.Int64), nil
+}
+
+// setAnswerHandler accepts a comment as the answer to a Q&A thread, or clears
+// the accepted answer for DELETE requests. Only the thread author and
+// moderators can change it. Answers must be top level comments, replies are
+// discussion of an answer.
+func setAnswerHandler(db *sql.DB, method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for SetAnswer")
+
+		if r.Method != method {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body AnswerAccept
+		if method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				log.Println("Error decoding request body:", err)
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		author, _, err := lockThread(tx, threadID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+			log.Println("Error getting thread from database:", err)
+			return
+		}
+
+		if user != author {
+			moderator, err := isModerator(db, user)
+			if err != nil {
+				http.Error(w, "Failed to get user role", http.StatusInternalServerError)
+				log.Println("Error getting user role:", err)
+				return
+			}
+			if !moderator {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		var answer *int64
+		if method == http.MethodPost {
+			var qaMode bool
+			query := "SELECT " + qaModeColumn + " FROM THREADS t LEFT JOIN CATEGORIES c ON c.id = t.category_id WHERE t.id = ?"
+			if err := tx.QueryRow(query, threadID).Scan(&qaMode); err != nil {
+				http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+				log.Println("Error getting thread from database:", err)
+				return
+			}
+			if !qaMode {
+				http.Error(w, "Thread is not in Q&A mode", http.StatusBadRequest)
+				return
+			}
+
+			var commentThreadID, depth int
+			query = "SELECT thread_id, depth FROM COMMENTS WHERE id = ? AND deleted_at IS NULL"
+			err := tx.QueryRow(query, body.CommentID).Scan(&commentThreadID, &depth)
+			if err == sql.ErrNoRows || (err == nil && commentThreadID != threadID) {
+				http.Error(w, "Comment not found in this thread", http.StatusBadRequest)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to get comment", http.StatusInternalServerError)
+				log.Println("Error getting comment from database:", err)
+				return
+			}
+			if depth != 0 {
+				http.Error(w, "Only top level comments can be accepted as answers", http.StatusBadRequest)
+				return
+			}
+			answer = &body.CommentID
+		}
+
+		if _, err := tx.Exec("UPDATE THREADS SET accepted_comment_id = ? WHERE id = ?", answer, threadID); err != nil {
+			http.Error(w, "Failed to update data", http.StatusInternalServerError)
+			log.Println("Error updating data in database:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Accepted answer of thread %d set by %s", threadID, user)
+	}
+}
+
+// AcceptAnswerHandler marks a comment as the accepted answer of a thread
+func AcceptAnswerHandler(db *sql.DB) http.HandlerFunc {
+	return setAnswerHandler(db, http.MethodPost)
+}
+
+// ClearAnswerHandler removes the accepted answer of a thread
+func ClearAnswerHandler(db *sql.DB) http.HandlerFunc {
+	return setAnswerHandler(db, http.MethodDelete)
+}
+
+// SetCategoryQAModeHandler turns Q&A mode on or off for the threads of a
+// category that do not set it themselves. Moderators only.
+func SetCategoryQAModeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for SetCategoryQAMode")
+
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		categoryID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Category ID", http.StatusBadRequest)
+			log.Println("Invalid Category ID:", err)
+			return
+		}
+
+		var body CategoryQAMode
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec("UPDATE CATEGORIES SET qa_mode = ? WHERE id = ?", body.QAMode, categoryID)
+		if err != nil {
+			http.Error(w, "Failed to update data", http.StatusInternalServerError)
+			log.Println("Error updating data in database:", err)
+			return
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			var exists bool
+			if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM CATEGORIES WHERE id = ?)", categoryID).Scan(&exists); err == nil && !exists {
+				http.Error(w, "Category not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		// Threads that follow the category lose their accepted answers with it
+		if !body.QAMode {
+			query := "UPDATE THREADS SET accepted_comment_id = NULL WHERE category_id = ? AND qa_mode IS NULL"
+			if _, err := tx.Exec(query, categoryID); err != nil {
+				http.Error(w, "Failed to update data", http.StatusInternalServerError)
+				log.Println("Error updating data in database:", err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Q&A mode of category %d set to %t", categoryID, body.QAMode)
+	}
+}
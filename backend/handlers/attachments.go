@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"web-forum/storage"
+
+	"github.com/gorilla/mux"
+)
+
+const maxAttachmentSize = 10 << 20 // 10 MB
+
+// Content types are sniffed from the uploaded bytes, the type sent by the
+// client is ignored
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":                 true,
+	"image/jpeg":                true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+type AttachmentGet struct {
+	ID          int    `json:"id"`
+	ThreadID    *int   `json:"thread_id"`
+	CommentID   *int   `json:"comment_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+	Time        string `json:"time"`
+}
+
+func newStorageKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// UploadAttachmentHandler stores a file uploaded as multipart form field "file"
+// and links it to a thread or comment (form field "thread_id" or "comment_id")
+// written by the uploader
+func UploadAttachmentHandler(db *sql.DB, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for UploadAttachment")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var user_id int
+		err := db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		if err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		// Leave some room for the multipart boundaries and other form fields
+		r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+(1<<20))
+		if err := r.ParseMultipartForm(maxAttachmentSize); err != nil {
+			http.Error(w, "File is too large or request is malformed", http.StatusRequestEntityTooLarge)
+			log.Println("Error parsing multipart form:", err)
+			return
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "File is required", http.StatusBadRequest)
+			log.Println("Error reading uploaded file:", err)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusBadRequest)
+			log.Println("Error reading uploaded file:", err)
+			return
+		}
+
+		if len(data) == 0 {
+			http.Error(w, "File is empty", http.StatusBadRequest)
+			log.Println("File is empty")
+			return
+		}
+
+		if len(data) > maxAttachmentSize {
+			http.Error(w, "File is too large", http.StatusRequestEntityTooLarge)
+			log.Println("File is too large")
+			return
+		}
+
+		contentType := http.DetectContentType(data)
+		if !allowedAttachmentTypes[contentType] {
+			http.Error(w, "File type is not allowed", http.StatusUnsupportedMediaType)
+			log.Println("File type is not allowed:", contentType)
+			return
+		}
+
+		threadIDStr := r.FormValue("thread_id")
+		commentIDStr := r.FormValue("comment_id")
+		if (threadIDStr == "") == (commentIDStr == "") {
+			http.Error(w, "Exactly one of thread_id and comment_id is required", http.StatusBadRequest)
+			log.Println("Attachment target is missing or ambiguous")
+			return
+		}
+
+		var attachment AttachmentGet
+		var author string
+		if threadIDStr != "" {
+			threadID, convErr := strconv.Atoi(threadIDStr)
+			if convErr != nil {
+				http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+				log.Println("Invalid Thread ID:", convErr)
+				return
+			}
+			attachment.ThreadID = &threadID
+			err = db.QueryRow("SELECT author FROM THREADS WHERE id=?", threadID).Scan(&author)
+		} else {
+			commentID, convErr := strconv.Atoi(commentIDStr)
+			if convErr != nil {
+				http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+				log.Println("Invalid comment ID:", convErr)
+				return
+			}
+			attachment.CommentID = &commentID
+			err = db.QueryRow("SELECT author FROM COMMENTS WHERE id=?", commentID).Scan(&author)
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment target not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get author", http.StatusInternalServerError)
+			log.Println("Error getting author from database:", err)
+			return
+		}
+
+		if user != author {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		key, err := newStorageKey()
+		if err != nil {
+			http.Error(w, "Failed to store file", http.StatusInternalServerError)
+			log.Println("Error generating storage key:", err)
+			return
+		}
+
+		if err := store.Put(r.Context(), key, data, contentType); err != nil {
+			http.Error(w, "Failed to store file", http.StatusInternalServerError)
+			log.Println("Error storing file:", err)
+			return
+		}
+
+		attachment.Filename = filepath.Base(header.Filename)
+		// VARCHAR(255) counts characters, cutting bytes could split one
+		if runes := []rune(attachment.Filename); len(runes) > 255 {
+			attachment.Filename = string(runes[:255])
+		}
+		attachment.ContentType = contentType
+		attachment.Size = int64(len(data))
+
+		query := "INSERT INTO ATTACHMENTS (storage_key, filename, content_type, size, uploader_id, thread_id, comment_id) VALUES (?, ?, ?, ?, ?, ?, ?)"
+		result, err := db.Exec(query, key, attachment.Filename, contentType, attachment.Size, user_id, attachment.ThreadID, attachment.CommentID)
+		if err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			attachment.ID = int(id)
+		}
+		if err != nil {
+			if err := store.Delete(r.Context(), key); err != nil {
+				log.Println("Error removing orphaned file:", err)
+			}
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		attachment.URL = fmt.Sprintf("/api/attachments/%d", attachment.ID)
+		attachment.Time = time.Now().UTC().Format(time.RFC3339)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(attachment); err != nil {
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully uploaded attachment %d by user %s", attachment.ID, user)
+	}
+}
+
+// GetAttachmentHandler serves the contents of an attachment
+func GetAttachmentHandler(db *sql.DB, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetAttachment")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			log.Println("Invalid attachment ID:", err)
+			return
+		}
+
+		// Attachments of scheduled threads stay hidden with the thread
+		query := `
+    SELECT a.storage_key, a.filename, a.content_type, a.size, a.created_at
+    FROM ATTACHMENTS a
+    LEFT JOIN COMMENTS c ON c.id = a.comment_id
+    JOIN THREADS t ON t.id = COALESCE(a.thread_id, c.thread_id)
+    WHERE a.id = ? AND t.published = TRUE`
+		var key, filename, contentType string
+		var size int64
+		var createdAt time.Time
+		err = db.QueryRow(query, id).Scan(&key, &filename, &contentType, &size, &createdAt)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		// Stored files never change, so the storage key doubles as the ETag.
+		// They can still be deleted, so caches have to revalidate.
+		etag := `"` + key + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=60, must-revalidate")
+		w.Header().Set("Last-Modified", createdAt.UTC().Format(http.TimeFormat))
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		blob, err := store.Get(r.Context(), key)
+		if err == storage.ErrNotFound {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			log.Println("Attachment file missing from storage:", key)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			log.Println("Error reading file from storage:", err)
+			return
+		}
+		defer blob.Close()
+
+		disposition := "attachment"
+		if strings.HasPrefix(contentType, "image/") {
+			disposition = "inline"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		if _, err := io.Copy(w, blob); err != nil {
+			log.Println("Error writing attachment:", err)
+			return
+		}
+
+		log.Printf("Successfully served attachment %d", id)
+	}
+}
+
+// GetThreadAttachmentsHandler lists the attachments of a thread and its comments
+func GetThreadAttachmentsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetThreadAttachments")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		query := `
+    SELECT a.id, a.thread_id, a.comment_id, a.filename, a.content_type, a.size, a.created_at
+    FROM ATTACHMENTS a
+    LEFT JOIN COMMENTS c ON c.id = a.comment_id
+    JOIN THREADS t ON t.id = COALESCE(a.thread_id, c.thread_id)
+    WHERE t.id = ? AND t.published = TRUE
+    ORDER BY a.id`
+		rows, err := db.Query(query, threadID)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		var attachments []AttachmentGet
+		for rows.Next() {
+			var attachment AttachmentGet
+			var attachmentThreadID, commentID sql.NullInt64
+			var createdAt time.Time
+			if err := rows.Scan(&attachment.ID, &attachmentThreadID, &commentID, &attachment.Filename, &attachment.ContentType, &attachment.Size, &createdAt); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			if attachmentThreadID.Valid {
+				id := int(attachmentThreadID.Int64)
+				attachment.ThreadID = &id
+			}
+			if commentID.Valid {
+				id := int(commentID.Int64)
+				attachment.CommentID = &id
+			}
+			attachment.URL = fmt.Sprintf("/api/attachments/%d", attachment.ID)
+			attachment.Time = createdAt.Format(time.RFC3339)
+			attachments = append(attachments, attachment)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(attachments); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched attachments for thread with ID %d", threadID)
+	}
+}
+
+// deleteBlobs removes the files of attachments whose rows were deleted. The
+// rows are gone already, so a leftover file is only wasted space.
+func deleteBlobs(ctx context.Context, store storage.BlobStore, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Println("Error deleting file from storage:", err)
+		}
+	}
+}
+
+// DeleteAttachmentHandler removes an attachment uploaded by the logged in user
+func DeleteAttachmentHandler(db *sql.DB, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for DeleteAttachment")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			log.Println("Invalid attachment ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var key string
+		query := "SELECT a.storage_key FROM ATTACHMENTS a JOIN USERS u ON u.id = a.uploader_id WHERE a.id=? AND u.username=?"
+		err = db.QueryRow(query, id, user).Scan(&key)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		if _, err := db.Exec("DELETE FROM ATTACHMENTS WHERE id=?", id); err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting data from database:", err)
+			return
+		}
+
+		// The row is gone already, a leftover file is only wasted space
+		if err := store.Delete(r.Context(), key); err != nil {
+			log.Println("Error deleting file from storage:", err)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully deleted"}`))
+		log.Println("Attachment deleted successfully")
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// BookmarkGet is a saved thread or comment. For comments, Title is the title
+// of the thread the comment belongs to.
+type BookmarkGet struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	ThreadID  int    `json:"thread_id"`
+	CommentID *int   `json:"comment_id"`
+	Title     string `json:"title"`
+	Excerpt   string `json:"excerpt"`
+	Author    string `json:"author"`
+	Time      string `json:"time"`
+}
+
+type BookmarkListGet struct {
+	Bookmarks  []BookmarkGet `json:"bookmarks"`
+	NextCursor *int64        `json:"next_cursor"`
+}
+
+// placeholders returns "?, ?, ?" for n query arguments
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// bookmarkedIDs returns which of the given thread or comment IDs the user has
+// bookmarked. column is either "thread_id" or "comment_id".
+func bookmarkedIDs(db *sql.DB, user string, column string, ids []int) (map[int]bool, error) {
+	bookmarked := make(map[int]bool)
+	if user == "" || len(ids) == 0 {
+		return bookmarked, nil
+	}
+
+	query := `
+    SELECT b.` + column + `
+    FROM BOOKMARKS b
+    JOIN USERS u ON u.id = b.user_id
+    WHERE u.username = ? AND b.` + column + ` IN (` + placeholders(len(ids)) + `)`
+	args := []any{user}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		bookmarked[id] = true
+	}
+	return bookmarked, rows.Err()
+}
+
+// markBookmarkedThreads sets the bookmarked flag of threads for the viewer
+func markBookmarkedThreads(db *sql.DB, user string, threads []ThreadGet) error {
+	ids := make([]int, len(threads))
+	for i, thread := range threads {
+		ids[i] = thread.ID
+	}
+
+	bookmarked, err := bookmarkedIDs(db, user, "thread_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range threads {
+		threads[i].Bookmarked = bookmarked[threads[i].ID]
+	}
+	return nil
+}
+
+// markBookmarkedComments sets the bookmarked flag of comments for the viewer
+func markBookmarkedComments(db *sql.DB, user string, comments []CommentGet) error {
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	bookmarked, err := bookmarkedIDs(db, user, "comment_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Bookmarked = bookmarked[comments[i].ID]
+	}
+	return nil
+}
+
+// bookmarkHandler adds or removes a bookmark on a thread or comment for the
+// logged in user, depending on the request method
+func bookmarkHandler(db *sql.DB, targetType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for Bookmark %s", targetType)
+
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			log.Println("Invalid ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var user_id int
+		err = db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		if err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		column := "thread_id"
+		if targetType == "comment" {
+			column = "comment_id"
+		}
+
+		if r.Method == http.MethodDelete {
+			_, err = db.Exec("DELETE FROM BOOKMARKS WHERE user_id = ? AND "+column+" = ?", user_id, id)
+			if err != nil {
+				http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+				log.Println("Error deleting data from database:", err)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"message":"Data successfully deleted"}`))
+			log.Printf("Removed bookmark on %s %d for user %s", targetType, id, user)
+			return
+		}
+
+		// Only content that is visible to everyone can be bookmarked
+		var exists bool
+		if targetType == "comment" {
+			query := "SELECT EXISTS(SELECT 1 FROM COMMENTS c JOIN THREADS t ON t.id = c.thread_id WHERE c.id = ? AND t.published = TRUE)"
+			err = db.QueryRow(query, id).Scan(&exists)
+		} else {
+			exists, err = threadIsPublished(db, id)
+		}
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		if !exists {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		_, err = db.Exec("INSERT IGNORE INTO BOOKMARKS (user_id, "+column+") VALUES (?, ?)", user_id, id)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Added bookmark on %s %d for user %s", targetType, id, user)
+	}
+}
+
+// ThreadBookmarkHandler bookmarks (POST) or un-bookmarks (DELETE) a thread
+func ThreadBookmarkHandler(db *sql.DB) http.HandlerFunc {
+	return bookmarkHandler(db, "thread")
+}
+
+// CommentBookmarkHandler bookmarks (POST) or un-bookmarks (DELETE) a comment
+func CommentBookmarkHandler(db *sql.DB) http.HandlerFunc {
+	return bookmarkHandler(db, "comment")
+}
+
+// GetBookmarksHandler returns the logged in user's bookmarks, most recently
+// saved first. Supports ?limit= and ?cursor= (the next_cursor of the previous page).
+func GetBookmarksHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetBookmarks")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		params := r.URL.Query()
+		limit := 20
+		if limitStr := params.Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		query := `
+    SELECT b.id, t.id, c.id, t.title, COALESCE(c.content, t.description), COALESCE(c.author, t.author), b.created_at
+    FROM BOOKMARKS b
+    JOIN USERS u ON u.id = b.user_id
+    LEFT JOIN COMMENTS c ON c.id = b.comment_id
+    JOIN THREADS t ON t.id = COALESCE(b.thread_id, c.thread_id)
+    WHERE u.username = ? AND t.published = TRUE`
+		args := []any{user}
+		if cursorStr := params.Get("cursor"); cursorStr != "" {
+			cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			query += " AND b.id < ?"
+			args = append(args, cursor)
+		}
+		query += " ORDER BY b.id DESC LIMIT ?"
+		args = append(args, limit+1)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		response := BookmarkListGet{Bookmarks: []BookmarkGet{}}
+		for rows.Next() {
+			var bookmark BookmarkGet
+			var commentID sql.NullInt64
+			var text string
+			var bookmarkTime time.Time
+			if err := rows.Scan(&bookmark.ID, &bookmark.ThreadID, &commentID, &bookmark.Title, &text, &bookmark.Author, &bookmarkTime); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			bookmark.Type = "thread"
+			if commentID.Valid {
+				id := int(commentID.Int64)
+				bookmark.CommentID = &id
+				bookmark.Type = "comment"
+			}
+			bookmark.Excerpt = excerpt(text)
+			bookmark.Time = bookmarkTime.Format(time.RFC3339)
+			response.Bookmarks = append(response.Bookmarks, bookmark)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		if len(response.Bookmarks) > limit {
+			response.Bookmarks = response.Bookmarks[:limit]
+			next := response.Bookmarks[limit-1].ID
+			response.NextCursor = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched bookmarks for user %s", user)
+	}
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// CommentContextGet is a comment with what a client needs to show it in
+// place. Ancestors are ordered from the top level comment down. PageCursor is
+// the ?cursor= of GetCommentsByThreadHandler, in the default order and with
+// the same ?limit=, for the page the comment's top level comment is on. It is
+// null for the first page.
+type CommentContextGet struct {
+	Comment        CommentGet   `json:"comment"`
+	Thread         ThreadGet    `json:"thread"`
+	Ancestors      []CommentGet `json:"ancestors"`
+	SiblingsBefore []CommentGet `json:"siblings_before"`
+	SiblingsAfter  []CommentGet `json:"siblings_after"`
+	PageCursor     *string      `json:"page_cursor"`
+}
+
+// queryComments selects comments with commentColumns and the given conditions
+func queryComments(db *sql.DB, conditions string, args ...any) ([]CommentGet, error) {
+	rows, err := db.Query("SELECT "+commentColumns+" FROM COMMENTS c WHERE "+conditions, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if comments == nil {
+		comments = []CommentGet{}
+	}
+	return comments, err
+}
+
+// GetCommentHandler retrieves a comment by ID together with its thread, its
+// ancestors and ?context= siblings (default 3) on either side, in the order
+// they were posted
+func GetCommentHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetComment")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		commentID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Comment ID", http.StatusBadRequest)
+			log.Println("Invalid Comment ID:", err)
+			return
+		}
+
+		params := r.URL.Query()
+		siblings := 3
+		if contextStr := params.Get("context"); contextStr != "" {
+			siblings, err = strconv.Atoi(contextStr)
+			if err != nil || siblings < 0 || siblings > 20 {
+				http.Error(w, "Invalid context", http.StatusBadRequest)
+				return
+			}
+		}
+		limit := 20
+		if limitStr := params.Get("limit"); limitStr != "" {
+			limit, err = strconv.Atoi(limitStr)
+			if err != nil || limit < 1 || limit > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		comments, err := queryComments(db, "c.id = ? AND EXISTS(SELECT 1 FROM THREADS t WHERE t.id = c.thread_id AND t.published = TRUE)", commentID)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		if len(comments) == 0 {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+
+		var response CommentContextGet
+		response.Comment = comments[0]
+		threadID := response.Comment.ThreadID
+
+		user := r.Context().Value("user").(string)
+		threads, err := queryThreads(db, user, " AND t.id = ?", threadID)
+		if err != nil || len(threads) == 0 {
+			http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+			log.Println("Error getting thread:", err)
+			return
+		}
+		response.Thread = threads[0]
+
+		var path, createdAt string
+		err = db.QueryRow("SELECT path, created_at FROM COMMENTS WHERE id = ?", commentID).Scan(&path, &createdAt)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		createdKey, err := parseTimeKey(createdAt)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error parsing comment time:", err)
+			return
+		}
+
+		// Every segment of the path but the last is an ancestor, the first
+		// is the top level comment
+		segments := strings.Split(path, "/")
+		ancestorIDs := []any{}
+		rootID := commentID
+		for i, segment := range segments[:len(segments)-1] {
+			id, err := strconv.Atoi(segment)
+			if err != nil {
+				http.Error(w, "Failed to query database", http.StatusInternalServerError)
+				log.Println("Error parsing comment path:", err)
+				return
+			}
+			ancestorIDs = append(ancestorIDs, id)
+			if i == 0 {
+				rootID = id
+			}
+		}
+		response.Ancestors = []CommentGet{}
+		if len(ancestorIDs) > 0 {
+			response.Ancestors, err = queryComments(db, "c.id IN ("+placeholders(len(ancestorIDs))+") ORDER BY c.path", ancestorIDs...)
+			if err != nil {
+				http.Error(w, "Failed to query database", http.StatusInternalServerError)
+				log.Println("Error querying database:", err)
+				return
+			}
+		}
+
+		var parentID any
+		if response.Comment.ParentID != nil {
+			parentID = *response.Comment.ParentID
+		}
+		sameParent := "c.thread_id = ? AND c.parent_id <=> ? AND "
+		response.SiblingsBefore, err = queryComments(db,
+			sameParent+"(c.created_at, c.id) < (?, ?) ORDER BY c.created_at DESC, c.id DESC LIMIT ?",
+			threadID, parentID, createdKey, commentID, siblings)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		for i, j := 0, len(response.SiblingsBefore)-1; i < j; i, j = i+1, j-1 {
+			response.SiblingsBefore[i], response.SiblingsBefore[j] = response.SiblingsBefore[j], response.SiblingsBefore[i]
+		}
+		response.SiblingsAfter, err = queryComments(db,
+			sameParent+"(c.created_at, c.id) > (?, ?) ORDER BY c.created_at, c.id LIMIT ?",
+			threadID, parentID, createdKey, commentID, siblings)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		accepted, err := acceptedAnswer(db, threadID)
+		if err == nil {
+			response.PageCursor, err = commentPageCursor(db, threadID, commentSorts["oldest"], rootID, limit, accepted)
+		}
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error finding comment page:", err)
+			return
+		}
+
+		// Mark everything in one go, then copy the marked comment back
+		all := []CommentGet{response.Comment}
+		all = append(all, response.Ancestors...)
+		all = append(all, response.SiblingsBefore...)
+		all = append(all, response.SiblingsAfter...)
+		if err := markBookmarkedComments(db, user, all); err != nil {
+			http.Error(w, "Failed to get bookmarks", http.StatusInternalServerError)
+			log.Println("Error getting bookmarks:", err)
+			return
+		}
+
+		if err := markMentionedComments(db, all); err != nil {
+			http.Error(w, "Failed to get mentions", http.StatusInternalServerError)
+			log.Println("Error getting mentions:", err)
+			return
+		}
+
+		if err := markQuotedComments(db, all); err != nil {
+			http.Error(w, "Failed to get quotes", http.StatusInternalServerError)
+			log.Println("Error getting quotes:", err)
+			return
+		}
+
+		response.Comment = all[0]
+		rest := all[1:]
+		response.Ancestors, rest = rest[:len(response.Ancestors)], rest[len(response.Ancestors):]
+		response.SiblingsBefore, rest = rest[:len(response.SiblingsBefore)], rest[len(response.SiblingsBefore):]
+		response.SiblingsAfter = rest
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched comment with ID %d", commentID)
+	}
+}
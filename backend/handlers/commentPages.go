@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+type CommentListGet struct {
+	Comments   []CommentGet `json:"comments"`
+	NextCursor *string      `json:"next_cursor"`
+}
+
+// commentSort orders top level comments by key, with the comment ID breaking
+// ties so every comment has a fixed place in the order
+type commentSort struct {
+	key            string
+	descending     bool
+	idDescending   bool
+	parseCursorKey func(string) (any, error)
+}
+
+func parseTimeKey(key string) (any, error) {
+	return time.Parse(time.RFC3339Nano, key)
+}
+
+func parseIntKey(key string) (any, error) {
+	return strconv.ParseInt(key, 10, 64)
+}
+
+func parseFloatKey(key string) (any, error) {
+	return strconv.ParseFloat(key, 64)
+}
+
+// Comment sort orders by ?sort= name. "top" is likes minus dislikes, "best" is
+// the lower bound of the Wilson score interval of the share of likes, which
+// does not favour comments with only a few likes over widely liked ones.
+var commentSorts = map[string]commentSort{
+	"oldest": {key: "created_at", parseCursorKey: parseTimeKey},
+	"newest": {key: "created_at", descending: true, idDescending: true, parseCursorKey: parseTimeKey},
+	"top":    {key: "score", descending: true, parseCursorKey: parseIntKey},
+	"best":   {key: "wilson", descending: true, parseCursorKey: parseFloatKey},
+}
+
+// rankedRootsQuery selects the top level comments of a thread, except the one
+// given as the second argument, with every sort key, so the keys can be used
+// in WHERE and ORDER BY. The Wilson lower bound uses z = 1.96 for 95% confidence.
+const rankedRootsQuery = `
+    SELECT id, created_at, likes - dislikes AS score,
+        IF(likes + dislikes = 0, 0,
+            (CAST(likes AS DOUBLE) / (likes + dislikes) + 1.9208 / (likes + dislikes)
+                - 1.96 * SQRT(CAST(likes * dislikes AS DOUBLE) / (likes + dislikes) + 0.9604) / (likes + dislikes))
+            / (1 + 3.8416 / (likes + dislikes))) AS wilson
+    FROM (
+        SELECT c.id, c.created_at,
+            (SELECT COUNT(*) FROM COMMENT_REACTIONS WHERE comment_id = c.id AND reaction = 'like') AS likes,
+            (SELECT COUNT(*) FROM COMMENT_REACTIONS WHERE comment_id = c.id AND reaction = 'dislike') AS dislikes
+        FROM COMMENTS c
+        JOIN THREADS t ON t.id = c.thread_id
+        WHERE c.thread_id = ? AND c.id <> ? AND t.published = TRUE AND c.depth = 0
+    ) counted`
+
+// directions returns the ORDER BY direction of the key and the ID, and the
+// operators that select comments coming after a given one
+func (s commentSort) directions() (keyOrder, keyOp, idOrder, idOp string) {
+	keyOrder, keyOp = "ASC", ">"
+	if s.descending {
+		keyOrder, keyOp = "DESC", "<"
+	}
+	idOrder, idOp = "ASC", ">"
+	if s.idDescending {
+		idOrder, idOp = "DESC", "<"
+	}
+	return keyOrder, keyOp, idOrder, idOp
+}
+
+// encodeCommentCursor makes an opaque cursor from the sort key and ID of the
+// last comment on a page
+func encodeCommentCursor(key string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key + "," + strconv.Itoa(id)))
+}
+
+func decodeCommentCursor(s commentSort, cursor string) (key any, id int, err error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+	keyStr, idStr, ok := strings.Cut(string(decoded), ",")
+	if !ok {
+		return nil, 0, errors.New("malformed cursor")
+	}
+	if key, err = s.parseCursorKey(keyStr); err != nil {
+		return nil, 0, err
+	}
+	id, err = strconv.Atoi(idStr)
+	return key, id, err
+}
+
+// pageCommentRoots returns the IDs of the top level comments of a thread on the
+// page after cursor, in sort order, and the cursor of the next page. A limit
+// of 0 returns all of them. The pinned comment is left out, callers list it
+// before the first page.
+func pageCommentRoots(db *sql.DB, threadID int, s commentSort, cursor string, limit int, pinned int) ([]int, *string, error) {
+	query := "SELECT id, " + s.key + " FROM (" + rankedRootsQuery + ") ranked"
+	args := []any{threadID, pinned}
+
+	keyOrder, keyOp, idOrder, idOp := s.directions()
+
+	if cursor != "" {
+		key, id, err := decodeCommentCursor(s, cursor)
+		if err != nil {
+			return nil, nil, errInvalidCursor
+		}
+		query += " WHERE " + s.key + " " + keyOp + " ? OR (" + s.key + " = ? AND id " + idOp + " ?)"
+		args = append(args, key, key, id)
+	}
+	query += " ORDER BY " + s.key + " " + keyOrder + ", id " + idOrder
+	if limit > 0 {
+		// Fetch one extra row to know whether there is another page
+		query += " LIMIT ?"
+		args = append(args, limit+1)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	var keys []string
+	for rows.Next() {
+		var id int
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *string
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+		cursor := encodeCommentCursor(keys[limit-1], ids[limit-1])
+		next = &cursor
+	}
+	return ids, next, nil
+}
+
+// previousPageEnd returns the position in sort order of the last comment on
+// the page before the one a comment is on, given how many comments come
+// before it, or -1 when the comment is on the first page
+func previousPageEnd(before int, limit int) int {
+	if before < limit {
+		return -1
+	}
+	return before/limit*limit - 1
+}
+
+// commentPageCursor returns the cursor of the page of limit top level comments
+// that the given top level comment is on, or nil for the first page. The
+// pinned comment is listed before the first page.
+func commentPageCursor(db *sql.DB, threadID int, s commentSort, rootID int, limit int, pinned int) (*string, error) {
+	if rootID == pinned {
+		return nil, nil
+	}
+
+	keyOrder, keyOp, idOrder, idOp := s.directions()
+	ranked := "(" + rankedRootsQuery + ") ranked"
+
+	var keyStr string
+	query := "SELECT " + s.key + " FROM " + ranked + " WHERE id = ?"
+	if err := db.QueryRow(query, threadID, pinned, rootID).Scan(&keyStr); err != nil {
+		return nil, err
+	}
+	// Read back like a cursor key so it compares the same way
+	key, err := s.parseCursorKey(keyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	// Comments before this one are those the opposite operators select
+	var before int
+	query = "SELECT COUNT(*) FROM " + ranked + " WHERE NOT (" + s.key + " " + keyOp + " ? OR (" + s.key + " = ? AND id " + idOp + " ?)) AND id <> ?"
+	if err := db.QueryRow(query, threadID, pinned, key, key, rootID, rootID).Scan(&before); err != nil {
+		return nil, err
+	}
+	offset := previousPageEnd(before, limit)
+	if offset < 0 {
+		return nil, nil
+	}
+
+	// The page starts after the last comment of the previous page
+	var lastID int
+	var lastKey string
+	query = "SELECT id, " + s.key + " FROM " + ranked + " ORDER BY " + s.key + " " + keyOrder + ", id " + idOrder + " LIMIT 1 OFFSET ?"
+	if err := db.QueryRow(query, threadID, pinned, offset).Scan(&lastID, &lastKey); err != nil {
+		return nil, err
+	}
+	cursor := encodeCommentCursor(lastKey, lastID)
+	return &cursor, nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCommentCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		sort string
+		key  string
+		id   int
+		want any
+	}{
+		{"oldest", "2024-05-01T10:00:00Z", 42, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)},
+		{"newest", "2024-05-01T10:00:00.123456Z", 7, time.Date(2024, 5, 1, 10, 0, 0, 123456000, time.UTC)},
+		{"top", "-3", 1, int64(-3)},
+		{"best", "0.2065432", 99, 0.2065432},
+	}
+	for _, tt := range tests {
+		cursor := encodeCommentCursor(tt.key, tt.id)
+		key, id, err := decodeCommentCursor(commentSorts[tt.sort], cursor)
+		if err != nil {
+			t.Errorf("%s: decodeCommentCursor(%q) failed: %v", tt.sort, cursor, err)
+			continue
+		}
+		if id != tt.id {
+			t.Errorf("%s: id = %d, want %d", tt.sort, id, tt.id)
+		}
+		if got, ok := key.(time.Time); ok {
+			if !got.Equal(tt.want.(time.Time)) {
+				t.Errorf("%s: key = %v, want %v", tt.sort, got, tt.want)
+			}
+		} else if key != tt.want {
+			t.Errorf("%s: key = %#v, want %#v", tt.sort, key, tt.want)
+		}
+	}
+}
+
+func TestDecodeCommentCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"not base64", "oldest", "!!!"},
+		{"no separator", "oldest", encode("2024-05-01T10:00:00Z")},
+		{"bad time", "oldest", encode("yesterday,1")},
+		{"bad score", "top", encode("1.5,1")},
+		{"bad wilson", "best", encode("high,1")},
+		{"bad id", "top", encode("3,abc")},
+		{"time key for a score sort", "top", encodeCommentCursor("2024-05-01T10:00:00Z", 1)},
+	}
+	for _, tt := range tests {
+		if _, _, err := decodeCommentCursor(commentSorts[tt.sort], tt.cursor); err == nil {
+			t.Errorf("%s: decodeCommentCursor(%q) succeeded", tt.name, tt.cursor)
+		}
+	}
+}
+
+func TestCommentSortDirections(t *testing.T) {
+	tests := []struct {
+		sort                           string
+		keyOrder, keyOp, idOrder, idOp string
+	}{
+		{"oldest", "ASC", ">", "ASC", ">"},
+		{"newest", "DESC", "<", "DESC", "<"},
+		{"top", "DESC", "<", "ASC", ">"},
+		{"best", "DESC", "<", "ASC", ">"},
+	}
+	for _, tt := range tests {
+		keyOrder, keyOp, idOrder, idOp := commentSorts[tt.sort].directions()
+		if keyOrder != tt.keyOrder || keyOp != tt.keyOp || idOrder != tt.idOrder || idOp != tt.idOp {
+			t.Errorf("%s: directions() = %s %s %s %s, want %s %s %s %s", tt.sort,
+				keyOrder, keyOp, idOrder, idOp, tt.keyOrder, tt.keyOp, tt.idOrder, tt.idOp)
+		}
+	}
+}
+
+func TestPreviousPageEnd(t *testing.T) {
+	tests := []struct {
+		before, limit int
+		want          int
+	}{
+		{0, 20, -1},
+		{19, 20, -1},
+		{20, 20, 19},
+		{21, 20, 19},
+		{39, 20, 19},
+		{40, 20, 39},
+		{0, 1, -1},
+		{1, 1, 0},
+		{5, 1, 4},
+		{250, 100, 199},
+	}
+	for _, tt := range tests {
+		if got := previousPageEnd(tt.before, tt.limit); got != tt.want {
+			t.Errorf("previousPageEnd(%d, %d) = %d, want %d", tt.before, tt.limit, got, tt.want)
+		}
+	}
+}
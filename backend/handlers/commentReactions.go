@@ -10,9 +10,12 @@ import (
 	"github.com/gorilla/mux"
 )
 
+// CommentReactionGet counts the reactions to a comment. Likes and Dislikes are
+// kept for clients of the original like/dislike routes.
 type CommentReactionGet struct {
-	Likes    int `json:"like"`
-	Dislikes int `json:"dislike"`
+	Likes    int            `json:"like"`
+	Dislikes int            `json:"dislike"`
+	Counts   map[string]int `json:"counts"`
 }
 
 type CommentReactionCreate struct {
@@ -41,22 +44,17 @@ func GetCommentReaction(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "SELECT COUNT(*) FROM COMMENT_REACTIONS WHERE comment_id=? AND state=?"
-		likeRow := db.QueryRow(query, id, 1)
-		dislikeRow := db.QueryRow(query, id, 0)
-
-		var reaction CommentReactionGet
-		if err := likeRow.Scan(&reaction.Likes); err != nil {
-			http.Error(w, "Failed to parse database row", http.StatusInternalServerError)
-			log.Println("Error parsing database row:", err)
-			return
-		}
-		if err := dislikeRow.Scan(&reaction.Dislikes); err != nil {
-			http.Error(w, "Failed to parse database row", http.StatusInternalServerError)
-			log.Println("Error parsing database row:", err)
+		counts, err := reactionCounts(db, commentReactions, []int{id})
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
 			return
 		}
 
+		reaction := CommentReactionGet{Counts: countsOrEmpty(counts[id])}
+		reaction.Likes = reaction.Counts[reactionLike]
+		reaction.Dislikes = reaction.Counts[reactionDislike]
+
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(reaction); err != nil {
 			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
@@ -94,26 +92,16 @@ func GetCommentUserReaction(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		var user_id int
-		err = db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		reactions, err := viewerReactions(db, commentReactions, user, []int{id})
 		if err != nil {
-			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
-			log.Println("Error getting user ID:", err)
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
 			return
 		}
 
-		query := "SELECT state FROM COMMENT_REACTIONS WHERE comment_id=? AND user_id=?"
-		row := db.QueryRow(query, id, user_id)
-
-		var reaction CommentReactionCreate
-		if err := row.Scan(&reaction.Reaction); err != nil {
-			if err == sql.ErrNoRows {
-				reaction.Reaction = "none"
-			} else {
-				http.Error(w, "Failed to parse database row", http.StatusInternalServerError)
-				log.Println("Error parsing database row:", err)
-				return
-			}
+		reaction := UserReactionGet{Reaction: legacyState(reactions[id]), Reactions: reactions[id]}
+		if reaction.Reactions == nil {
+			reaction.Reactions = []string{}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -170,9 +158,35 @@ func UpdateCommentReaction(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "INSERT INTO COMMENT_REACTIONS (user_id,comment_id,state) VALUES(?,?,?) ON DUPLICATE KEY UPDATE state = VALUES(state)"
+		// "1" likes and "0" dislikes, other reactions have their own route
+		reaction, ok := legacyReaction(body.Reaction)
+		if !ok {
+			http.Error(w, "Invalid reaction", http.StatusBadRequest)
+			return
+		}
 
-		_, err = db.Exec(query, user_id, id, body.Reaction)
+		available, err := commentReactions.available(db, id)
+		if err != nil {
+			http.Error(w, "Failed to get comment", http.StatusInternalServerError)
+			log.Println("Error getting comment from database:", err)
+			return
+		}
+		if !available {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+
+		added, err := addReaction(db, commentReactions, id, user_id, reaction)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		// Only a new like notifies the author, not switching an existing reaction
+		if added && reaction == reactionLike {
+			notifyCommentReaction(db, id, user, reaction)
+		}
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully submitted"}`))
@@ -218,9 +232,12 @@ func DeleteCommentReaction(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "DELETE FROM COMMENT_REACTIONS WHERE user_id=? AND comment_id=?"
-
-		_, err = db.Exec(query, user_id, id)
+		// Other reactions are removed through their own route
+		if err := removeReactions(db, commentReactions, id, user_id, reactionLike, reactionDislike); err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting data from database:", err)
+			return
+		}
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully deleted"}`))
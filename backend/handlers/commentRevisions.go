@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Edits within this long of posting a comment fix typos without being shown
+// as edits or keeping the previous version
+const commentEditGracePeriod = 5 * time.Minute
+
+// CommentRevisionGet is an earlier version of a comment. Time is when that
+// version was written and ReplacedAt when an edit replaced it.
+type CommentRevisionGet struct {
+	Content     string `json:"content"`
+	ContentHTML string `json:"content_html"`
+	Time        string `json:"time"`
+	ReplacedAt  string `json:"replaced_at"`
+}
+
+// recordCommentRevision keeps the current version of a comment before it is
+// replaced by content, and marks the comment as edited. Nothing is recorded
+// for edits in the grace period or edits that change nothing.
+func recordCommentRevision(tx *sql.Tx, commentID int, content string) error {
+	var current string
+	var inGracePeriod bool
+	query := "SELECT content, created_at > NOW() - INTERVAL ? SECOND FROM COMMENTS WHERE id = ? FOR UPDATE"
+	err := tx.QueryRow(query, int(commentEditGracePeriod.Seconds()), commentID).Scan(&current, &inGracePeriod)
+	if err != nil {
+		return err
+	}
+	if inGracePeriod || current == content {
+		return nil
+	}
+
+	return execAll(tx, []statement{
+		{`INSERT INTO COMMENT_REVISIONS (comment_id, content, content_html, written_at)
+    SELECT id, content, content_html, COALESCE(edited_at, created_at) FROM COMMENTS WHERE id = ?`, []any{commentID}},
+		{"UPDATE COMMENTS SET edited_at = CURRENT_TIMESTAMP, edit_count = edit_count + 1 WHERE id = ?", []any{commentID}},
+	})
+}
+
+// GetCommentRevisionsHandler lists the earlier versions of a comment, oldest
+// first. Only the author and moderators can see them.
+func GetCommentRevisionsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetCommentRevisions")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		commentID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Comment ID", http.StatusBadRequest)
+			log.Println("Invalid Comment ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var author string
+		err = db.QueryRow("SELECT author FROM COMMENTS WHERE id = ?", commentID).Scan(&author)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get author", http.StatusInternalServerError)
+			log.Println("Error getting author from database:", err)
+			return
+		}
+
+		if user != author {
+			moderator, err := isModerator(db, user)
+			if err != nil {
+				http.Error(w, "Failed to get user role", http.StatusInternalServerError)
+				log.Println("Error getting user role:", err)
+				return
+			}
+			if !moderator {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		query := `
+    SELECT content, content_html, written_at, created_at
+    FROM COMMENT_REVISIONS
+    WHERE comment_id = ?
+    ORDER BY id`
+		rows, err := db.Query(query, commentID)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		revisions := []CommentRevisionGet{}
+		for rows.Next() {
+			var revision CommentRevisionGet
+			var contentHTML sql.NullString
+			var writtenAt, replacedAt time.Time
+			if err := rows.Scan(&revision.Content, &contentHTML, &writtenAt, &replacedAt); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			revision.ContentHTML = renderedHTML(contentHTML, revision.Content)
+			revision.Time = writtenAt.Format(time.RFC3339)
+			revision.ReplacedAt = replacedAt.Format(time.RFC3339)
+			revisions = append(revisions, revision)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+			log.Println("Error parsing database row:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(revisions); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched revisions of comment with ID %d", commentID)
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Top level comments have depth 0, replies to them depth 1 and so on
+const maxCommentDepth = 8
+
+var (
+	errParentNotFound = errors.New("Parent comment not found in this thread")
+	errReplyTooDeep   = errors.New("Replies cannot be nested this deep")
+)
+
+// commentColumns are read by scanComments. Comments are ordered by path to
+// list every reply right after its parent.
+const commentColumns = `c.id, c.thread_id, c.parent_id, c.depth, c.content, c.content_html, c.author, c.created_at,
+        c.edited_at, c.edit_count, (SELECT COUNT(*) FROM COMMENTS r WHERE r.parent_id = c.id),
+        EXISTS(SELECT 1 FROM THREADS a WHERE a.accepted_comment_id = c.id), c.deleted_by`
+
+// commentParent checks that a comment can be replied to in a thread and returns
+// its path and depth
+func commentParent(db queryExecer, threadID int, parentID int64) (path string, depth int, err error) {
+	var parentThreadID int
+	query := "SELECT thread_id, path, depth FROM COMMENTS WHERE id = ? AND deleted_at IS NULL"
+	err = db.QueryRow(query, parentID).Scan(&parentThreadID, &path, &depth)
+	if err == sql.ErrNoRows || (err == nil && parentThreadID != threadID) {
+		return "", 0, errParentNotFound
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if depth >= maxCommentDepth {
+		return "", 0, errReplyTooDeep
+	}
+	return path, depth, nil
+}
+
+// setCommentPath sets the path of a new comment, which is the path of its
+// parent followed by its own zero padded ID. parentPath is "" for top level
+// comments. The path sorts replies after their parent and makes a subtree a
+// prefix range.
+func setCommentPath(db execer, commentID int64, parentPath string) error {
+	if parentPath != "" {
+		parentPath += "/"
+	}
+	_, err := db.Exec("UPDATE COMMENTS SET path = CONCAT(?, LPAD(id, 20, '0')) WHERE id = ?", parentPath, commentID)
+	return err
+}
+
+// scanComments reads rows selected with commentColumns
+func scanComments(rows *sql.Rows) ([]CommentGet, error) {
+	var comments []CommentGet
+	for rows.Next() {
+		var comment CommentGet
+		var parentID sql.NullInt64
+		var contentHTML sql.NullString
+		var commentTime time.Time
+		var editedAt sql.NullTime
+		var deletedBy sql.NullString
+		err := rows.Scan(&comment.ID, &comment.ThreadID, &parentID, &comment.Depth, &comment.Content, &contentHTML,
+			&comment.Author, &commentTime, &editedAt, &comment.EditCount, &comment.ReplyCount, &comment.Accepted, &deletedBy)
+		if err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			parent := int(parentID.Int64)
+			comment.ParentID = &parent
+		}
+		comment.ContentHTML = renderedHTML(contentHTML, comment.Content)
+		comment.Time = commentTime.Format(time.RFC3339)
+		comment.Deleted = deletedBy.Valid
+		comment.DeletedBy = deletedBy.String
+		if editedAt.Valid {
+			edited := editedAt.Time.Format(time.RFC3339)
+			comment.EditedAt = &edited
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// commentTree nests comments, ordered by path, under their parents. Comments
+// whose parent is not in the list are returned as roots.
+func commentTree(comments []CommentGet) []CommentGet {
+	present := make(map[int]bool)
+	children := make(map[int][]int)
+	var roots []int
+	for i, comment := range comments {
+		if comment.ParentID != nil && present[*comment.ParentID] {
+			children[*comment.ParentID] = append(children[*comment.ParentID], i)
+		} else {
+			roots = append(roots, i)
+		}
+		present[comment.ID] = true
+	}
+
+	var build func(i int) CommentGet
+	build = func(i int) CommentGet {
+		comment := comments[i]
+		for _, child := range children[comment.ID] {
+			comment.Replies = append(comment.Replies, build(child))
+		}
+		return comment
+	}
+
+	tree := []CommentGet{}
+	for _, root := range roots {
+		tree = append(tree, build(root))
+	}
+	return tree
+}
+
+// commentListOptions reads ?format= (flat or tree) and ?depth=, the number of
+// reply levels to include
+func commentListOptions(r *http.Request) (tree bool, depth int, err error) {
+	params := r.URL.Query()
+	switch params.Get("format") {
+	case "", "flat":
+	case "tree":
+		tree = true
+	default:
+		return false, 0, errors.New("Invalid format")
+	}
+
+	depth = maxCommentDepth
+	if depthStr := params.Get("depth"); depthStr != "" {
+		depth, err = strconv.Atoi(depthStr)
+		if err != nil || depth < 0 || depth > maxCommentDepth {
+			return false, 0, errors.New("Invalid depth")
+		}
+	}
+	return tree, depth, nil
+}
+
+// GetCommentRepliesHandler retrieves the replies below a comment, so clients
+// can load deep subtrees that were cut off by ?depth= on demand. Supports the
+// same ?format= and ?depth= as GetCommentsByThreadHandler, with depth counted
+// from the comment.
+func GetCommentRepliesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetCommentReplies")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		commentID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Comment ID", http.StatusBadRequest)
+			log.Println("Invalid Comment ID:", err)
+			return
+		}
+
+		tree, depth, err := commentListOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var threadID, commentDepth int
+		var path string
+		query := "SELECT c.thread_id, c.path, c.depth FROM COMMENTS c JOIN THREADS t ON t.id = c.thread_id WHERE c.id = ? AND t.published = TRUE"
+		if err := db.QueryRow(query, commentID).Scan(&threadID, &path, &commentDepth); err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		query = `
+    SELECT ` + commentColumns + `
+    FROM COMMENTS c
+    WHERE c.thread_id = ? AND c.path LIKE ? AND c.depth <= ?
+    ORDER BY c.path`
+		rows, err := db.Query(query, threadID, path+"/%", commentDepth+depth)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		comments, err := scanComments(rows)
+		if err != nil {
+			http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+			log.Println("Error parsing database row:", err)
+			return
+		}
+
+		if err := markBookmarkedComments(db, r.Context().Value("user").(string), comments); err != nil {
+			http.Error(w, "Failed to get bookmarks", http.StatusInternalServerError)
+			log.Println("Error getting bookmarks:", err)
+			return
+		}
+
+		if err := markMentionedComments(db, comments); err != nil {
+			http.Error(w, "Failed to get mentions", http.StatusInternalServerError)
+			log.Println("Error getting mentions:", err)
+			return
+		}
+
+		if err := markQuotedComments(db, comments); err != nil {
+			http.Error(w, "Failed to get quotes", http.StatusInternalServerError)
+			log.Println("Error getting quotes:", err)
+			return
+		}
+
+		var response any = comments
+		if tree {
+			response = commentTree(comments)
+		} else if comments == nil {
+			response = []CommentGet{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched replies of comment with ID %d", commentID)
+	}
+}
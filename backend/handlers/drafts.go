@@ -0,0 +1,460 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"web-forum/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// A draft with a nil ThreadID is a thread draft, otherwise it is a
+// comment draft for the thread with that ID.
+type DraftGet struct {
+	ID       int    `json:"id"`
+	ThreadID *int   `json:"thread_id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Category string `json:"category"`
+	Time     string `json:"time"`
+}
+
+type DraftCreate struct {
+	ThreadID *int   `json:"thread_id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Category string `json:"category"`
+}
+
+type DraftCreateResponse struct {
+	Message string `json:"message"`
+	ID      int64  `json:"id"`
+}
+
+type DraftPublishResponse struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	ID      int64  `json:"id"`
+}
+
+// findCategoryIDByName returns a NULL category ID for an empty name so drafts
+// can be saved before a category has been picked
+func findCategoryIDByName(db *sql.DB, category string) (sql.NullInt64, error) {
+	var categoryID sql.NullInt64
+	if category == "" {
+		return categoryID, nil
+	}
+	err := db.QueryRow("SELECT id FROM CATEGORIES WHERE category=?", category).Scan(&categoryID)
+	return categoryID, err
+}
+
+// GetDraftsHandler retrieves all drafts of the logged in user
+func GetDraftsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetDrafts")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := `
+    SELECT d.id, d.thread_id, d.title, d.content, c.category, d.updated_at
+    FROM DRAFTS d
+    JOIN USERS u ON u.id = d.user_id
+    LEFT JOIN CATEGORIES c ON c.id = d.category_id
+    WHERE u.username = ?
+    ORDER BY d.updated_at DESC`
+		rows, err := db.Query(query, user)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		var drafts []DraftGet
+		for rows.Next() {
+			var draft DraftGet
+			var threadID sql.NullInt64
+			var category sql.NullString
+			var draftTime time.Time
+			if err := rows.Scan(&draft.ID, &threadID, &draft.Title, &draft.Content, &category, &draftTime); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			if threadID.Valid {
+				id := int(threadID.Int64)
+				draft.ThreadID = &id
+			}
+			draft.Category = category.String
+			draft.Time = draftTime.Format(time.RFC3339)
+			drafts = append(drafts, draft)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(drafts); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched drafts for user %s", user)
+	}
+}
+
+// CreateDraftHandler saves a new thread or comment draft for the logged in user
+func CreateDraftHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for CreateDraft")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var user_id int
+		err := db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		if err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		var body DraftCreate
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if len(body.Title) > 100 {
+			http.Error(w, "Title is too long", http.StatusBadRequest)
+			log.Println("Title is too long")
+			return
+		}
+
+		categoryID, err := findCategoryIDByName(db, body.Category)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			log.Println("Invalid category:", body.Category)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get category ID", http.StatusInternalServerError)
+			log.Println("Error getting category ID from database:", err)
+			return
+		}
+
+		query := "INSERT INTO DRAFTS (user_id, thread_id, title, content, category_id) VALUES (?, ?, ?, ?, ?)"
+		result, err := db.Exec(query, user_id, body.ThreadID, body.Title, body.Content, categoryID)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		draftID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to get draft ID", http.StatusInternalServerError)
+			log.Println("Error getting draft ID:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(DraftCreateResponse{Message: "Data successfully submitted", ID: draftID}); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+		log.Println("Draft created successfully")
+	}
+}
+
+// UpdateDraftHandler overwrites the contents of an existing draft
+func UpdateDraftHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for UpdateDraft")
+
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		draftID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Draft ID", http.StatusBadRequest)
+			log.Println("Invalid Draft ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body DraftCreate
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if len(body.Title) > 100 {
+			http.Error(w, "Title is too long", http.StatusBadRequest)
+			log.Println("Title is too long")
+			return
+		}
+
+		categoryID, err := findCategoryIDByName(db, body.Category)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			log.Println("Invalid category:", body.Category)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get category ID", http.StatusInternalServerError)
+			log.Println("Error getting category ID from database:", err)
+			return
+		}
+
+		// The thread a comment draft belongs to is fixed at creation
+		query := `
+    UPDATE DRAFTS d JOIN USERS u ON u.id = d.user_id
+    SET d.title=?, d.content=?, d.category_id=?
+    WHERE d.id=? AND u.username=?`
+		result, err := db.Exec(query, body.Title, body.Content, categoryID, draftID, user)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			var exists bool
+			err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM DRAFTS d JOIN USERS u ON u.id = d.user_id WHERE d.id=? AND u.username=?)", draftID, user).Scan(&exists)
+			if err == nil && !exists {
+				http.Error(w, "Draft not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Println("Draft updated successfully")
+	}
+}
+
+// DeleteDraftHandler discards a draft of the logged in user
+func DeleteDraftHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for DeleteDraft")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		draftID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Draft ID", http.StatusBadRequest)
+			log.Println("Invalid Draft ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := "DELETE d FROM DRAFTS d JOIN USERS u ON u.id = d.user_id WHERE d.id=? AND u.username=?"
+		_, err = db.Exec(query, draftID, user)
+		if err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting data from database:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully deleted"}`))
+		log.Println("Draft deleted successfully")
+	}
+}
+
+// PublishDraftHandler turns a draft into a real thread or comment and removes
+// the draft in the same transaction
+func PublishDraftHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for PublishDraft")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		draftID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Draft ID", http.StatusBadRequest)
+			log.Println("Invalid Draft ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		var threadID, categoryID sql.NullInt64
+		var title, content string
+		query := `
+    SELECT d.thread_id, d.title, d.content, d.category_id
+    FROM DRAFTS d JOIN USERS u ON u.id = d.user_id
+    WHERE d.id=? AND u.username=?
+    FOR UPDATE`
+		err = tx.QueryRow(query, draftID, user).Scan(&threadID, &title, &content, &categoryID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Draft not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get draft", http.StatusInternalServerError)
+			log.Println("Error getting draft from database:", err)
+			return
+		}
+
+		contentHTML, err := utils.RenderMarkdown(content)
+		if err != nil {
+			http.Error(w, "Failed to render content", http.StatusInternalServerError)
+			log.Println("Error rendering markdown:", err)
+			return
+		}
+
+		var response DraftPublishResponse
+		var result sql.Result
+		if threadID.Valid {
+			if content == "" {
+				http.Error(w, "Content is required.", http.StatusBadRequest)
+				log.Println("Content is required.")
+				return
+			}
+
+			var published bool
+			err = tx.QueryRow("SELECT published FROM THREADS WHERE id=?", threadID.Int64).Scan(&published)
+			if err == sql.ErrNoRows || (err == nil && !published) {
+				http.Error(w, "Thread not found", http.StatusNotFound)
+				log.Println("Thread not found:", threadID.Int64)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+				log.Println("Error getting thread from database:", err)
+				return
+			}
+
+			response.Type = "comment"
+			result, err = tx.Exec("INSERT INTO COMMENTS (content, content_html, author, thread_id) VALUES (?, ?, ?, ?)", content, contentHTML, user, threadID.Int64)
+		} else {
+			if title == "" || content == "" {
+				http.Error(w, "Title and Description are required", http.StatusBadRequest)
+				log.Println("Title or Description is missing")
+				return
+			}
+
+			if !categoryID.Valid {
+				http.Error(w, "Category is required", http.StatusBadRequest)
+				log.Println("Category is missing")
+				return
+			}
+
+			response.Type = "thread"
+			result, err = tx.Exec("INSERT INTO THREADS (title, description, description_html, author, category_id) VALUES (?, ?, ?, ?, ?)", title, content, contentHTML, user, categoryID.Int64)
+		}
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		response.ID, err = result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error getting inserted ID:", err)
+			return
+		}
+
+		if response.Type == "thread" {
+			if _, err := assignThreadSlug(tx, response.ID, title); err != nil {
+				http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+				log.Println("Error assigning thread slug:", err)
+				return
+			}
+		} else if err := setCommentPath(tx, response.ID, ""); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error setting comment path:", err)
+			return
+		}
+
+		if _, err = tx.Exec("DELETE FROM DRAFTS WHERE id=?", draftID); err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting draft from database:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		if response.Type == "thread" {
+			threadPublished(db, response.ID, user)
+		} else {
+			commentCreated(db, threadID.Int64, response.ID, user, content)
+		}
+
+		response.Message = "Data successfully submitted"
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully published draft %d as %s %d", draftID, response.Type, response.ID)
+	}
+}
@@ -10,6 +10,7 @@ import (
 type CategoryGet struct {
 	ID       int    `json:"id"`
 	Category string `json:"category"`
+	QAMode   bool   `json:"qa_mode"`
 }
 
 // GetAllCategoriesHandler retrieves all Threads from the database
@@ -23,7 +24,7 @@ func GetAllCategoriesHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		rows, err := db.Query("SELECT id,category FROM CATEGORIES")
+		rows, err := db.Query("SELECT id,category,qa_mode FROM CATEGORIES")
 		if err != nil {
 			http.Error(w, "Failed to query database", http.StatusInternalServerError)
 			log.Println("Error querying database:", err)
@@ -34,7 +35,7 @@ func GetAllCategoriesHandler(db *sql.DB) http.HandlerFunc {
 		var categories []CategoryGet
 		for rows.Next() {
 			var category CategoryGet
-			if err := rows.Scan(&category.ID, &category.Category); err != nil {
+			if err := rows.Scan(&category.ID, &category.Category, &category.QAMode); err != nil {
 				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
 				log.Println("Error parsing database row:", err)
 				return
@@ -3,23 +3,48 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"time"
+	"web-forum/utils"
 
 	"github.com/gorilla/mux"
 )
 
 type CommentGet struct {
-	ID       int    `json:"id"`
-	ThreadID int    `json:"thread_id"`
-	Content  string `json:"content"`
-	Author   string `json:"author"`
-	Time     string `json:"time"`
+	ID          int     `json:"id"`
+	ThreadID    int     `json:"thread_id"`
+	ParentID    *int    `json:"parent_id"`
+	Depth       int     `json:"depth"`
+	Content     string  `json:"content"`
+	ContentHTML string  `json:"content_html"`
+	Author      string  `json:"author"`
+	Time        string  `json:"time"`
+	EditedAt    *string `json:"edited_at"`
+	EditCount   int     `json:"edit_count"`
+	Bookmarked  bool    `json:"bookmarked"`
+	Accepted    bool    `json:"accepted"`
+	// Deleted comments that others replied to or quoted are kept as
+	// tombstones, DeletedBy is "author" or "moderator"
+	Deleted    bool            `json:"deleted"`
+	DeletedBy  string          `json:"deleted_by,omitempty"`
+	Mentions   []utils.Mention `json:"mentions"`
+	Quotes     []QuoteGet      `json:"quotes"`
+	ReplyCount int             `json:"reply_count"`
+	Replies    []CommentGet    `json:"replies,omitempty"`
 }
 
-// GetCommentsByThreadHandler retrieves all comments of a Thread from the database
+// GetCommentsByThreadHandler retrieves all comments of a Thread from the
+// database. Supports ?format=flat (default), a list where replies follow their
+// parent, or ?format=tree, with replies nested in their parent. ?depth= limits
+// how many levels of replies are included, reply_count tells which comments
+// have more replies to load with GetCommentRepliesHandler.
+//
+// ?sort= orders the top level comments by oldest (default), newest, top or
+// best, replies stay in the order they were posted. With ?limit= or ?cursor=
+// the top level comments are paginated and the response is a CommentListGet.
+// The accepted answer of a Q&A thread comes first, in addition to the first page.
 func GetCommentsByThreadHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -40,37 +65,136 @@ func GetCommentsByThreadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "SELECT id, content, author, created_at FROM COMMENTS WHERE thread_id=?"
-		rows, err := db.Query(query, threadID)
+		tree, depth, err := commentListOptions(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		params := r.URL.Query()
+		sortName := params.Get("sort")
+		if sortName == "" {
+			sortName = "oldest"
+		}
+		sort, ok := commentSorts[sortName]
+		if !ok {
+			http.Error(w, "Invalid sort", http.StatusBadRequest)
+			return
+		}
+
+		paginated := params.Has("limit") || params.Has("cursor")
+		limit := 0
+		if paginated {
+			limit = 20
+			if limitStr := params.Get("limit"); limitStr != "" {
+				limit, err = strconv.Atoi(limitStr)
+				if err != nil || limit < 1 || limit > 100 {
+					http.Error(w, "Invalid limit", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		accepted, err := acceptedAnswer(db, threadID)
 		if err != nil {
 			http.Error(w, "Failed to query database", http.StatusInternalServerError)
 			log.Println("Error querying database:", err)
 			return
 		}
-		defer rows.Close()
 
+		rootIDs, nextCursor, err := pageCommentRoots(db, threadID, sort, params.Get("cursor"), limit, accepted)
+		if err == errInvalidCursor {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		// The accepted answer is pinned above the first page
+		if accepted != 0 && params.Get("cursor") == "" {
+			rootIDs = append([]int{accepted}, rootIDs...)
+		}
+
+		// Replies keep their order below the top level comment they belong to
 		var comments []CommentGet
-		for rows.Next() {
-			var comment CommentGet
-			comment.ThreadID = threadID
-			var commentTime time.Time
-			if err := rows.Scan(&comment.ID, &comment.Content, &comment.Author, &commentTime); err != nil {
+		if len(rootIDs) > 0 {
+			subtrees := ""
+			args := []any{threadID, depth}
+			for i, id := range rootIDs {
+				if i > 0 {
+					subtrees += " OR "
+				}
+				subtrees += "c.path LIKE ?"
+				args = append(args, fmt.Sprintf("%020d%%", id))
+			}
+
+			query := `
+    SELECT ` + commentColumns + `
+    FROM COMMENTS c
+    WHERE c.thread_id = ? AND c.depth <= ? AND (` + subtrees + `)
+    ORDER BY c.path`
+			rows, err := db.Query(query, args...)
+			if err != nil {
+				http.Error(w, "Failed to query database", http.StatusInternalServerError)
+				log.Println("Error querying database:", err)
+				return
+			}
+			defer rows.Close()
+
+			byPath, err := scanComments(rows)
+			if err != nil {
 				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
 				log.Println("Error parsing database row:", err)
 				return
 			}
-			comment.Time = commentTime.Format(time.RFC3339)
-			comments = append(comments, comment)
+
+			subtree := make(map[int][]CommentGet)
+			root := 0
+			for _, comment := range byPath {
+				if comment.Depth == 0 {
+					root = comment.ID
+				}
+				subtree[root] = append(subtree[root], comment)
+			}
+			for _, id := range rootIDs {
+				comments = append(comments, subtree[id]...)
+			}
+		}
+
+		if err := markBookmarkedComments(db, r.Context().Value("user").(string), comments); err != nil {
+			http.Error(w, "Failed to get bookmarks", http.StatusInternalServerError)
+			log.Println("Error getting bookmarks:", err)
+			return
+		}
+
+		if err := markMentionedComments(db, comments); err != nil {
+			http.Error(w, "Failed to get mentions", http.StatusInternalServerError)
+			log.Println("Error getting mentions:", err)
+			return
 		}
 
-		if err := rows.Err(); err != nil {
-			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
-			log.Println("Error iterating database rows:", err)
+		if err := markQuotedComments(db, comments); err != nil {
+			http.Error(w, "Failed to get quotes", http.StatusInternalServerError)
+			log.Println("Error getting quotes:", err)
 			return
 		}
 
+		if tree {
+			comments = commentTree(comments)
+		}
+
+		var response any = comments
+		if paginated {
+			if comments == nil {
+				comments = []CommentGet{}
+			}
+			response = CommentListGet{Comments: comments, NextCursor: nextCursor}
+		}
+
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(comments); err != nil {
+		if err := json.NewEncoder(w).Encode(response); err != nil {
 			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
 			log.Println("Error encoding JSON:", err)
 		}
@@ -94,7 +218,7 @@ func GetCommentsByUserHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "SELECT id,thread_id, content, created_at FROM COMMENTS WHERE author=?"
+		query := "SELECT " + commentColumns + " FROM COMMENTS c WHERE c.author=?"
 		rows, err := db.Query(query, user)
 		if err != nil {
 			http.Error(w, "Failed to query database", http.StatusInternalServerError)
@@ -103,23 +227,28 @@ func GetCommentsByUserHandler(db *sql.DB) http.HandlerFunc {
 		}
 		defer rows.Close()
 
-		var comments []CommentGet
-		for rows.Next() {
-			var comment CommentGet
-			comment.Author = user
-			var commentTime time.Time
-			if err := rows.Scan(&comment.ID, &comment.ThreadID, &comment.Content, &commentTime); err != nil {
-				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
-				log.Println("Error parsing database row:", err)
-				return
-			}
-			comment.Time = commentTime.Format(time.RFC3339)
-			comments = append(comments, comment)
+		comments, err := scanComments(rows)
+		if err != nil {
+			http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+			log.Println("Error parsing database row:", err)
+			return
+		}
+
+		if err := markBookmarkedComments(db, r.Context().Value("user").(string), comments); err != nil {
+			http.Error(w, "Failed to get bookmarks", http.StatusInternalServerError)
+			log.Println("Error getting bookmarks:", err)
+			return
+		}
+
+		if err := markMentionedComments(db, comments); err != nil {
+			http.Error(w, "Failed to get mentions", http.StatusInternalServerError)
+			log.Println("Error getting mentions:", err)
+			return
 		}
 
-		if err := rows.Err(); err != nil {
-			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
-			log.Println("Error iterating database rows:", err)
+		if err := markQuotedComments(db, comments); err != nil {
+			http.Error(w, "Failed to get quotes", http.StatusInternalServerError)
+			log.Println("Error getting quotes:", err)
 			return
 		}
 
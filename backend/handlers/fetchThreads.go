@@ -7,27 +7,138 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+	"web-forum/utils"
 
 	"github.com/gorilla/mux"
 )
 
 type ThreadGet struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Author      string `json:"author"`
-	Category    string `json:"category"`
-	Time        string `json:"time"`
+	ID           int               `json:"id"`
+	Title        string            `json:"title"`
+	Slug         string            `json:"slug"`
+	Description  string            `json:"description"`
+	ContentHTML  string            `json:"content_html"`
+	Author       string            `json:"author"`
+	Category     string            `json:"category"`
+	Time         string            `json:"time"`
+	ViewCount    int               `json:"view_count"`
+	Reactions    ThreadReactionGet `json:"reactions"`
+	UserReaction string            `json:"user_reaction"`
+	CommentCount int               `json:"comment_count"`
+	LastActivity string            `json:"last_activity"`
+	QAMode       bool              `json:"qa_mode"`
+	Solved       bool              `json:"solved"`
+	AcceptedID   *int              `json:"accepted_comment_id"`
+	Bookmarked   bool              `json:"bookmarked"`
+	Mentions     []utils.Mention   `json:"mentions"`
+	Poll         *PollGet          `json:"poll,omitempty"`
 }
 
-func findCategoryByID(db *sql.DB, id int) (string, error) {
-	var category string
-	err := db.QueryRow("SELECT category FROM CATEGORIES WHERE id = ?", id).Scan(&category)
+// threadSummaryQuery selects threads together with their category, comment
+// count, last activity, Q&A state and the reaction of the viewer, whose
+// username is the first argument. Deleted comments are left out of the comment
+// count and last activity. Callers append their conditions.
+const threadSummaryQuery = `
+    SELECT t.id, t.title, COALESCE(t.slug, ''), t.description, t.description_html, t.author,
+        COALESCE(c.category, ''), t.created_at, t.view_count,
+        CASE viewer_reaction.reaction WHEN 'like' THEN 1 WHEN 'dislike' THEN 0 END,
+        (SELECT COUNT(*) FROM COMMENTS WHERE thread_id = t.id AND deleted_at IS NULL),
+        (SELECT MAX(created_at) FROM COMMENTS WHERE thread_id = t.id AND deleted_at IS NULL),
+        ` + qaModeColumn + `, t.accepted_comment_id
+    FROM THREADS t
+    LEFT JOIN CATEGORIES c ON c.id = t.category_id
+    LEFT JOIN USERS viewer ON viewer.username = ?
+    LEFT JOIN THREAD_REACTIONS viewer_reaction ON viewer_reaction.thread_id = t.id AND viewer_reaction.user_id = viewer.id
+        AND viewer_reaction.reaction IN ('like', 'dislike')
+    WHERE t.published = TRUE`
+
+// queryThreads runs threadSummaryQuery with the given extra conditions, marks
+// the threads the viewer has bookmarked and adds their mentions and reaction
+// counts
+func queryThreads(db *sql.DB, viewer string, conditions string, args ...any) ([]ThreadGet, error) {
+	rows, err := db.Query(threadSummaryQuery+conditions, append([]any{viewer}, args...)...)
 	if err != nil {
-		log.Println("Error querying database:", err)
-		return "", err
+		return nil, err
 	}
-	return category, nil
+	defer rows.Close()
+
+	var threads []ThreadGet
+	for rows.Next() {
+		var thread ThreadGet
+		var threadTime time.Time
+		var lastComment sql.NullTime
+		var descriptionHTML sql.NullString
+		var userReaction, accepted sql.NullInt64
+		err := rows.Scan(&thread.ID, &thread.Title, &thread.Slug, &thread.Description, &descriptionHTML, &thread.Author,
+			&thread.Category, &threadTime, &thread.ViewCount, &userReaction,
+			&thread.CommentCount, &lastComment, &thread.QAMode, &accepted)
+		if err != nil {
+			return nil, err
+		}
+
+		thread.ContentHTML = renderedHTML(descriptionHTML, thread.Description)
+		thread.Time = threadTime.Format(time.RFC3339)
+
+		lastActivity := threadTime
+		if lastComment.Valid && lastComment.Time.After(lastActivity) {
+			lastActivity = lastComment.Time
+		}
+		thread.LastActivity = lastActivity.Format(time.RFC3339)
+
+		if accepted.Valid {
+			id := int(accepted.Int64)
+			thread.AcceptedID = &id
+			thread.Solved = true
+		}
+
+		// Same values as GetThreadUserReaction
+		thread.UserReaction = "none"
+		if userReaction.Valid {
+			thread.UserReaction = strconv.FormatInt(userReaction.Int64, 10)
+		}
+
+		threads = append(threads, thread)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := markBookmarkedThreads(db, viewer, threads); err != nil {
+		return nil, err
+	}
+	if err := markMentionedThreads(db, threads); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(threads))
+	for i, thread := range threads {
+		ids[i] = thread.ID
+	}
+	counts, err := reactionCounts(db, threadReactions, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range threads {
+		reactions := &threads[i].Reactions
+		reactions.Counts = countsOrEmpty(counts[threads[i].ID])
+		reactions.Likes = reactions.Counts[reactionLike]
+		reactions.Dislikes = reactions.Counts[reactionDislike]
+	}
+	return threads, nil
+}
+
+// renderedHTML returns the stored HTML of a post, rendering the Markdown source
+// for rows saved before rendered HTML was stored alongside it
+func renderedHTML(html sql.NullString, source string) string {
+	if html.Valid {
+		return html.String
+	}
+	rendered, err := utils.RenderMarkdown(source)
+	if err != nil {
+		log.Println("Error rendering markdown:", err)
+		return ""
+	}
+	return rendered
 }
 
 // GetAllThreadsHandler retrieves all Threads from the database
@@ -41,36 +152,16 @@ func GetAllThreadsHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		rows, err := db.Query("SELECT id, title, description, author, category_id, created_at FROM THREADS")
+		solved, err := solvedFilter(r)
 		if err != nil {
-			http.Error(w, "Failed to query database", http.StatusInternalServerError)
-			log.Println("Error querying database:", err)
+			http.Error(w, "Invalid solved filter", http.StatusBadRequest)
 			return
 		}
-		defer rows.Close()
-
-		var threads []ThreadGet
-		for rows.Next() {
-			var thread ThreadGet
-			var threadTime time.Time
-			var categoryID int
-			if err := rows.Scan(&thread.ID, &thread.Title, &thread.Description, &thread.Author, &categoryID, &threadTime); err != nil {
-				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
-				log.Println("Error parsing database row:", err)
-				return
-			}
-			thread.Category, err = findCategoryByID(db, categoryID)
-			if err != nil {
-				http.Error(w, "Failed to find category", http.StatusInternalServerError)
-				return
-			}
-			thread.Time = threadTime.Format(time.RFC3339)
-			threads = append(threads, thread)
-		}
-
-		if err := rows.Err(); err != nil {
-			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
-			log.Println("Error iterating database rows:", err)
+
+		threads, err := queryThreads(db, r.Context().Value("user").(string), solved)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
 			return
 		}
 
@@ -99,43 +190,20 @@ func GetSearchThreadsHandler(db *sql.DB) http.HandlerFunc {
 		search := vars["searchTerm"]
 		log.Printf("Search Term: %s", search)
 
-		rows, err := db.Query(`
-    SELECT id, title, description, author, category_id, created_at
-    FROM THREADS
-    WHERE LOWER(title) LIKE LOWER(?) OR LOWER(description) LIKE LOWER(?)`,
-			"%"+search+"%", "%"+search+"%")
+		solved, err := solvedFilter(r)
+		if err != nil {
+			http.Error(w, "Invalid solved filter", http.StatusBadRequest)
+			return
+		}
 
+		threads, err := queryThreads(db, r.Context().Value("user").(string),
+			" AND (LOWER(t.title) LIKE LOWER(?) OR LOWER(t.description) LIKE LOWER(?))"+solved,
+			"%"+search+"%", "%"+search+"%")
 		if err != nil {
 			http.Error(w, "Failed to query database", http.StatusInternalServerError)
 			log.Println("Error querying database:", err)
 			return
 		}
-		defer rows.Close()
-
-		var threads []ThreadGet
-		for rows.Next() {
-			var thread ThreadGet
-			var threadTime time.Time
-			var categoryID int
-			if err := rows.Scan(&thread.ID, &thread.Title, &thread.Description, &thread.Author, &categoryID, &threadTime); err != nil {
-				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
-				log.Println("Error parsing database row:", err)
-				return
-			}
-			thread.Category, err = findCategoryByID(db, categoryID)
-			if err != nil {
-				http.Error(w, "Failed to find category", http.StatusInternalServerError)
-				return
-			}
-			thread.Time = threadTime.Format(time.RFC3339)
-			threads = append(threads, thread)
-		}
-
-		if err := rows.Err(); err != nil {
-			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
-			log.Println("Error iterating database rows:", err)
-			return
-		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(threads); err != nil {
@@ -147,8 +215,32 @@ func GetSearchThreadsHandler(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GetThreadByIDHandler retrieves a specific Thread by ID from the database
-func GetThreadByIDHandler(db *sql.DB) http.HandlerFunc {
+// loadThread reads a published thread with its poll and the viewer's bookmark,
+// counting the request as a view. Returns sql.ErrNoRows if there is no such thread.
+func loadThread(db *sql.DB, views *ViewCounter, r *http.Request, id int) (ThreadGet, error) {
+	threads, err := queryThreads(db, r.Context().Value("user").(string), " AND t.id = ?", id)
+	if err != nil {
+		return ThreadGet{}, err
+	}
+	if len(threads) == 0 {
+		return ThreadGet{}, sql.ErrNoRows
+	}
+	thread := threads[0]
+
+	views.Record(id, r)
+	thread.ViewCount += views.Pending(id)
+
+	thread.Poll, err = loadPoll(db, id)
+	if err != nil {
+		return thread, err
+	}
+
+	return thread, nil
+}
+
+// GetThreadByIDHandler retrieves a specific Thread by ID from the database and
+// counts the request as a view of the thread
+func GetThreadByIDHandler(db *sql.DB, views *ViewCounter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Received request for GetThreadByID")
 
@@ -169,24 +261,16 @@ func GetThreadByIDHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "SELECT title, description, author, category_id, created_at FROM THREADS WHERE id = ?"
-		row := db.QueryRow(query, id)
-
-		var thread ThreadGet
-		thread.ID = id
-		var threadTime time.Time
-		var categoryID int
-		if err := row.Scan(&thread.Title, &thread.Description, &thread.Author, &categoryID, &threadTime); err != nil {
-			http.Error(w, "Failed to parse database row", http.StatusInternalServerError)
-			log.Println("Error parsing database row:", err)
+		thread, err := loadThread(db, views, r, id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			log.Println("Thread not found:", id)
 			return
-		}
-		thread.Category, err = findCategoryByID(db, categoryID)
-		if err != nil {
-			http.Error(w, "Failed to find category", http.StatusInternalServerError)
+		} else if err != nil {
+			http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+			log.Println("Error getting thread:", err)
 			return
 		}
-		thread.Time = threadTime.Format(time.RFC3339)
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(thread); err != nil {
@@ -213,35 +297,18 @@ func GetThreadsByUserHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "SELECT id, title, description, category_id, created_at FROM THREADS WHERE author = ?"
-		rows, err := db.Query(query, user)
+		solved, err := solvedFilter(r)
+		if err != nil {
+			http.Error(w, "Invalid solved filter", http.StatusBadRequest)
+			return
+		}
 
+		threads, err := queryThreads(db, r.Context().Value("user").(string), " AND t.author = ?"+solved, user)
 		if err != nil {
 			http.Error(w, "Failed to query database", http.StatusInternalServerError)
 			log.Println("Error querying database:", err)
 			return
 		}
-		defer rows.Close()
-
-		var threads []ThreadGet
-		for rows.Next() {
-			var thread ThreadGet
-			thread.Author = user
-			var threadTime time.Time
-			var categoryID int
-			if err = rows.Scan(&thread.ID, &thread.Title, &thread.Description, &categoryID, &threadTime); err != nil {
-				http.Error(w, "Failed to parse database row", http.StatusInternalServerError)
-				log.Println("Error parsing database row:", err)
-				return
-			}
-			thread.Category, err = findCategoryByID(db, categoryID)
-			if err != nil {
-				http.Error(w, "Failed to find category", http.StatusInternalServerError)
-				return
-			}
-			thread.Time = threadTime.Format(time.RFC3339)
-			threads = append(threads, thread)
-		}
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(threads); err != nil {
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,55 +12,82 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Middleware to Validate JWT
-func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		encodedSecret := os.Getenv("JWT_SECRET")
+var errMissingAuthHeader = errors.New("Authorization header is missing")
 
-		decodedSecret, err := base64.StdEncoding.DecodeString(encodedSecret)
-		if err != nil {
-			return
-		}
+// userFromRequest validates the bearer token of a request and returns the
+// username it was issued for
+func userFromRequest(r *http.Request) (string, error) {
+	encodedSecret := os.Getenv("JWT_SECRET")
 
-		// Extract the token from the Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header is missing", http.StatusUnauthorized)
-			return
-		}
+	decodedSecret, err := base64.StdEncoding.DecodeString(encodedSecret)
+	if err != nil {
+		return "", err
+	}
 
-		// Check the format "Bearer <token>"
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		if tokenString == authHeader {
-			http.Error(w, "Authorization header format must be 'Bearer <token>'", http.StatusUnauthorized)
-			return
-		}
+	// Extract the token from the Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", errMissingAuthHeader
+	}
 
-		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Verify the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return decodedSecret, nil
-		})
+	// Check the format "Bearer <token>"
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+	if tokenString == authHeader {
+		return "", errors.New("Authorization header format must be 'Bearer <token>'")
+	}
 
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
+	// Parse and validate the token
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Verify the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		// If token is valid, extract claims and attach them to the request context
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return decodedSecret, nil
+	})
+
+	if err != nil || !token.Valid {
+		return "", errors.New("Invalid or expired token")
+	}
+	// If token is valid, extract claims
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", errors.New("Invalid token claims")
+	}
+
+	user, ok := claims["username"].(string)
+	if !ok {
+		return "", errors.New("Invalid token claims")
+	}
+	return user, nil
+}
+
+// Middleware to Validate JWT
+func JWTMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		// Attach the claims (or any specific data like the user ID) to the request context
-		user := claims["username"].(string) // Extracting username as an example
+		// Attach the username to the request context
 		ctx := context.WithValue(r.Context(), "user", user)
 
 		// Pass the request with the attached context to the next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// Middleware for public routes that show extra data to logged in users. The
+// user in the context is empty when the request has no valid token.
+func OptionalJWTMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromRequest(r)
+		if err != nil {
+			user = ""
+		}
+
+		ctx := context.WithValue(r.Context(), "user", user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
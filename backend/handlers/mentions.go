@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"web-forum/utils"
+)
+
+// syncMentions records the users mentioned in a thread or comment after it is
+// published or edited. column is "thread_id" or "comment_id" and id the ID of
+// the post. Every user is notified the first time they are mentioned in a post
+// only; mentions removed by an edit are kept as inactive so adding them back
+// does not notify again.
+func syncMentions(db *sql.DB, column string, id int64, threadID int64, author string, text string) error {
+	usernames := utils.MentionedUsernames(text)
+
+	var userIDs []int
+	if len(usernames) > 0 {
+		args := make([]any, len(usernames))
+		for i, username := range usernames {
+			args[i] = username
+		}
+		rows, err := db.Query("SELECT id FROM USERS WHERE username IN ("+placeholders(len(args))+")", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var userID int
+			if err := rows.Scan(&userID); err != nil {
+				return err
+			}
+			userIDs = append(userIDs, userID)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	notification := Notification{
+		Type:                NotificationMention,
+		Actor:               author,
+		ThreadID:            &threadID,
+		NotificationDetails: NotificationDetails{Excerpt: excerpt(text)},
+	}
+	if column == "comment_id" {
+		notification.CommentID = &id
+	}
+
+	for _, userID := range userIDs {
+		result, err := db.Exec("INSERT IGNORE INTO MENTIONS (user_id, "+column+") VALUES (?, ?)", userID, id)
+		if err != nil {
+			return err
+		}
+		// Nothing is inserted if the user was mentioned in the post before
+		if inserted, err := result.RowsAffected(); err != nil {
+			return err
+		} else if inserted == 0 {
+			continue
+		}
+		if err := emitNotification(db, userID, notification); err != nil {
+			return err
+		}
+	}
+
+	active := "FALSE"
+	var args []any
+	if len(userIDs) > 0 {
+		active = "user_id IN (" + placeholders(len(userIDs)) + ")"
+		for _, userID := range userIDs {
+			args = append(args, userID)
+		}
+	}
+	_, err := db.Exec("UPDATE MENTIONS SET active = "+active+" WHERE "+column+" = ?", append(args, id)...)
+	return err
+}
+
+// mentionedUsers returns the users actively mentioned in each of the given
+// threads or comments, keyed by post ID and lower case username
+func mentionedUsers(db *sql.DB, column string, ids []int) (map[int]map[string]string, error) {
+	mentioned := make(map[int]map[string]string)
+	if len(ids) == 0 {
+		return mentioned, nil
+	}
+
+	query := `
+    SELECT m.` + column + `, u.username
+    FROM MENTIONS m
+    JOIN USERS u ON u.id = m.user_id
+    WHERE m.active = TRUE AND m.` + column + ` IN (` + placeholders(len(ids)) + `)`
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var username string
+		if err := rows.Scan(&id, &username); err != nil {
+			return nil, err
+		}
+		if mentioned[id] == nil {
+			mentioned[id] = make(map[string]string)
+		}
+		mentioned[id][strings.ToLower(username)] = username
+	}
+	return mentioned, rows.Err()
+}
+
+// postMentions finds the mentions in text of the given users. Mentions are
+// returned with the username as registered, whatever case it was typed in.
+func postMentions(text string, users map[string]string) []utils.Mention {
+	mentions := []utils.Mention{}
+	for _, mention := range utils.ParseMentions(text) {
+		if username, ok := users[strings.ToLower(mention.Username)]; ok {
+			mention.Username = username
+			mentions = append(mentions, mention)
+		}
+	}
+	return mentions
+}
+
+// markMentionedThreads sets the mentions of threads, so clients can link them
+func markMentionedThreads(db *sql.DB, threads []ThreadGet) error {
+	ids := make([]int, len(threads))
+	for i, thread := range threads {
+		ids[i] = thread.ID
+	}
+
+	mentioned, err := mentionedUsers(db, "thread_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range threads {
+		threads[i].Mentions = postMentions(threads[i].Description, mentioned[threads[i].ID])
+	}
+	return nil
+}
+
+// markMentionedComments sets the mentions of comments, so clients can link them
+func markMentionedComments(db *sql.DB, comments []CommentGet) error {
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	mentioned, err := mentionedUsers(db, "comment_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Mentions = postMentions(comments[i].Content, mentioned[comments[i].ID])
+	}
+	return nil
+}
+
+// threadMentionsChanged syncs the mentions of a published thread's description
+func threadMentionsChanged(db *sql.DB, threadID int64) {
+	var author, description string
+	err := db.QueryRow("SELECT author, description FROM THREADS WHERE id = ?", threadID).Scan(&author, &description)
+	if err == nil {
+		err = syncMentions(db, "thread_id", threadID, threadID, author, description)
+	}
+	if err != nil {
+		log.Println("Error recording thread mentions:", err)
+	}
+}
@@ -0,0 +1,792 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const roleModerator = "moderator"
+
+type ThreadMerge struct {
+	Into   int    `json:"into"`
+	Reason string `json:"reason"`
+}
+
+type ThreadSplit struct {
+	CommentIDs []int64 `json:"comment_ids"`
+	Title      string  `json:"title"`
+	Category   string  `json:"category"`
+	Reason     string  `json:"reason"`
+}
+
+type ThreadMove struct {
+	Category string `json:"category"`
+	Reason   string `json:"reason"`
+}
+
+type ThreadSplitResponse struct {
+	ThreadID int64  `json:"thread_id"`
+	Slug     string `json:"slug"`
+}
+
+// ModerationDetails holds what changed in a moderation action. It is stored as
+// JSON in the details column of MODERATION_LOG.
+type ModerationDetails struct {
+	CommentIDs   []int64 `json:"comment_ids,omitempty"`
+	FromCategory string  `json:"from_category,omitempty"`
+	ToCategory   string  `json:"to_category,omitempty"`
+}
+
+type ModerationLogGet struct {
+	ID             int64             `json:"id"`
+	Moderator      string            `json:"moderator"`
+	Action         string            `json:"action"`
+	ThreadID       int               `json:"thread_id"`
+	TargetThreadID *int              `json:"target_thread_id"`
+	Details        ModerationDetails `json:"details"`
+	Reason         string            `json:"reason"`
+	Time           string            `json:"time"`
+}
+
+type ModerationLogListGet struct {
+	Entries    []ModerationLogGet `json:"entries"`
+	NextCursor *int64             `json:"next_cursor"`
+}
+
+// isModerator reports whether a user has the moderator role
+func isModerator(db *sql.DB, user string) (bool, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM USERS WHERE username = ?", user).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return role == roleModerator, err
+}
+
+// Middleware for moderator only routes, must be wrapped in JWTMiddleware
+func ModeratorMiddleware(db *sql.DB, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.Context().Value("user").(string)
+		moderator, err := isModerator(db, user)
+		if err != nil {
+			http.Error(w, "Failed to get user role", http.StatusInternalServerError)
+			log.Println("Error getting user role:", err)
+			return
+		}
+		if !moderator {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recordModeration adds an action to the moderation audit trail
+func recordModeration(tx *sql.Tx, moderator, action string, threadID int64, targetThreadID *int64, details ModerationDetails, reason string) error {
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	query := "INSERT INTO MODERATION_LOG (moderator, action, thread_id, target_thread_id, details, reason) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err = tx.Exec(query, moderator, action, threadID, targetThreadID, string(encoded), reason)
+	return err
+}
+
+// notifyModeration tells a user that a moderator changed their content. Users
+// that no longer exist are skipped.
+func notifyModeration(tx *sql.Tx, username string, n Notification) error {
+	var userID int
+	err := tx.QueryRow("SELECT id FROM USERS WHERE username = ?", username).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return emitNotification(tx, userID, n)
+}
+
+type statement struct {
+	query string
+	args  []any
+}
+
+// execAll runs statements in order and stops at the first error
+func execAll(tx *sql.Tx, statements []statement) error {
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockThread locks a published thread for the rest of the transaction and
+// returns its author and category. Returns sql.ErrNoRows if there is no such thread.
+func lockThread(tx *sql.Tx, threadID int) (author string, categoryID sql.NullInt64, err error) {
+	query := "SELECT author, category_id FROM THREADS WHERE id = ? AND published = TRUE FOR UPDATE"
+	err = tx.QueryRow(query, threadID).Scan(&author, &categoryID)
+	return author, categoryID, err
+}
+
+// MergeThreadHandler merges a thread into another one. The opening post of the
+// merged thread becomes a comment, and its comments, reactions, followers,
+// bookmarks and slugs move to the target thread before it is deleted. Reactions
+// of users who reacted to both threads keep the reaction on the target.
+func MergeThreadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for MergeThread")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+
+		var body ThreadMerge
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if body.Into == threadID {
+			http.Error(w, "Cannot merge a thread into itself", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		// Lock in ID order so two merges of the same threads cannot deadlock
+		first, second := threadID, body.Into
+		if first > second {
+			first, second = second, first
+		}
+		_, _, err = lockThread(tx, first)
+		if err == nil {
+			_, _, err = lockThread(tx, second)
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error locking threads:", err)
+			return
+		}
+
+		var description, author string
+		var descriptionHTML sql.NullString
+		var createdAt time.Time
+		query := "SELECT description, description_html, author, created_at FROM THREADS WHERE id = ?"
+		if err := tx.QueryRow(query, threadID).Scan(&description, &descriptionHTML, &author, &createdAt); err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		// The opening post is kept as a comment from the same author and time
+		query = "INSERT INTO COMMENTS (thread_id, content, content_html, author, created_at) VALUES (?, ?, ?, ?, ?)"
+		result, err := tx.Exec(query, body.Into, description, renderedHTML(descriptionHTML, description), author, createdAt)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+		openingPostID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error getting comment ID:", err)
+			return
+		}
+
+		if err := setCommentPath(tx, openingPostID, ""); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error setting comment path:", err)
+			return
+		}
+
+		statements := []statement{
+			{"UPDATE COMMENTS SET thread_id = ? WHERE thread_id = ?", []any{body.Into, threadID}},
+			{"UPDATE ATTACHMENTS SET thread_id = NULL, comment_id = ? WHERE thread_id = ?", []any{openingPostID, threadID}},
+			{"UPDATE MENTIONS SET thread_id = NULL, comment_id = ? WHERE thread_id = ?", []any{openingPostID, threadID}},
+			{"INSERT IGNORE INTO THREAD_REACTIONS (user_id, thread_id, reaction, created_at) SELECT user_id, ?, reaction, created_at FROM THREAD_REACTIONS WHERE thread_id = ?", []any{body.Into, threadID}},
+			// A user who liked one thread and disliked the other keeps the like
+			{`DELETE d FROM THREAD_REACTIONS d
+    JOIN THREAD_REACTIONS l ON l.user_id = d.user_id AND l.thread_id = d.thread_id AND l.reaction = 'like'
+    WHERE d.thread_id = ? AND d.reaction = 'dislike'`, []any{body.Into}},
+			{"INSERT IGNORE INTO THREAD_SUBSCRIPTIONS (user_id, thread_id, subscribed, created_at) SELECT user_id, ?, subscribed, created_at FROM THREAD_SUBSCRIPTIONS WHERE thread_id = ?", []any{body.Into, threadID}},
+			{"UPDATE IGNORE BOOKMARKS SET thread_id = ? WHERE thread_id = ?", []any{body.Into, threadID}},
+			{"UPDATE NOTIFICATIONS SET thread_id = ? WHERE thread_id = ?", []any{body.Into, threadID}},
+			{"UPDATE DRAFTS SET thread_id = ? WHERE thread_id = ?", []any{body.Into, threadID}},
+			// Links to the merged thread now lead to the target
+			{"UPDATE THREAD_SLUGS SET thread_id = ? WHERE thread_id = ?", []any{body.Into, threadID}},
+			{"UPDATE THREADS t JOIN THREADS merged ON merged.id = ? SET t.view_count = t.view_count + merged.view_count WHERE t.id = ?", []any{threadID, body.Into}},
+		}
+		if err := execAll(tx, statements); err != nil {
+			http.Error(w, "Failed to merge threads", http.StatusInternalServerError)
+			log.Println("Error merging threads:", err)
+			return
+		}
+
+		into := int64(body.Into)
+		if err := recordModeration(tx, user, "merge", int64(threadID), &into, ModerationDetails{}, body.Reason); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error recording moderation:", err)
+			return
+		}
+
+		err = notifyModeration(tx, author, Notification{
+			Type:                NotificationModeration,
+			Actor:               user,
+			ThreadID:            &into,
+			NotificationDetails: NotificationDetails{Action: "merge", Reason: body.Reason},
+		})
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error creating moderation notification:", err)
+			return
+		}
+
+		// Everything still referencing the merged thread (its poll and the
+		// reactions that were duplicates) is removed with it
+		if _, err := tx.Exec("DELETE FROM THREADS WHERE id = ?", threadID); err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting data from database:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		invalidateThreadIndex()
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Thread %d merged into thread %d by %s", threadID, body.Into, user)
+	}
+}
+
+// SplitThreadHandler moves selected comments of a thread and their replies
+// into a new thread. The oldest selected comment becomes the opening post of
+// the new thread.
+func SplitThreadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for SplitThread")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+
+		var body ThreadSplit
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if body.Title == "" || len(body.CommentIDs) == 0 {
+			http.Error(w, "Title and Comment IDs are required", http.StatusBadRequest)
+			log.Println("Title or Comment IDs are missing")
+			return
+		}
+
+		if len(body.Title) > 100 {
+			http.Error(w, "Title is too long", http.StatusBadRequest)
+			log.Println("Title is too long")
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		_, categoryID, err := lockThread(tx, threadID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error locking thread:", err)
+			return
+		}
+
+		if body.Category != "" {
+			err = tx.QueryRow("SELECT id FROM CATEGORIES WHERE category = ?", body.Category).Scan(&categoryID)
+			if err == sql.ErrNoRows {
+				http.Error(w, "Invalid category", http.StatusBadRequest)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to get category ID", http.StatusInternalServerError)
+				log.Println("Error getting category ID from database:", err)
+				return
+			}
+		}
+
+		args := []any{threadID}
+		seen := make(map[int64]bool)
+		for _, id := range body.CommentIDs {
+			if !seen[id] {
+				seen[id] = true
+				args = append(args, id)
+			}
+		}
+
+		query := "SELECT path, deleted_at IS NOT NULL FROM COMMENTS WHERE thread_id = ? AND id IN (" + placeholders(len(seen)) + ") FOR UPDATE"
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		// Replies to the selected comments move along with them
+		subtrees := ""
+		args = []any{threadID}
+		deleted := false
+		for rows.Next() {
+			var path string
+			var isDeleted bool
+			if err := rows.Scan(&path, &isDeleted); err != nil {
+				rows.Close()
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			if subtrees != "" {
+				subtrees += " OR "
+			}
+			subtrees += "path = ? OR path LIKE ?"
+			args = append(args, path, path+"/%")
+			deleted = deleted || isDeleted
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		if len(args)-1 != 2*len(seen) {
+			http.Error(w, "Comments must belong to the thread", http.StatusBadRequest)
+			return
+		}
+
+		// The oldest selected comment becomes the opening post, a deleted one
+		// has nothing left to open the thread with
+		if deleted {
+			http.Error(w, "Deleted comments cannot be split off", http.StatusBadRequest)
+			return
+		}
+
+		query = `
+    SELECT id, parent_id, path, depth, content, content_html, author, created_at
+    FROM COMMENTS
+    WHERE thread_id = ? AND (` + subtrees + `)
+    ORDER BY created_at, id
+    FOR UPDATE`
+		rows, err = tx.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		type comment struct {
+			id          int64
+			parentID    sql.NullInt64
+			path        string
+			depth       int
+			content     string
+			contentHTML sql.NullString
+			author      string
+			createdAt   time.Time
+		}
+		var comments []comment
+		moved := make(map[int64]bool)
+		for rows.Next() {
+			var c comment
+			if err := rows.Scan(&c.id, &c.parentID, &c.path, &c.depth, &c.content, &c.contentHTML, &c.author, &c.createdAt); err != nil {
+				rows.Close()
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			comments = append(comments, c)
+			moved[c.id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		// The oldest comment cannot be a reply to another moved comment
+		opening := comments[0]
+		query = "INSERT INTO THREADS (title, description, description_html, author, category_id, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+		result, err := tx.Exec(query, body.Title, opening.content, renderedHTML(opening.contentHTML, opening.content), opening.author, categoryID, opening.createdAt)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		newThreadID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error getting thread ID:", err)
+			return
+		}
+
+		slug, err := assignThreadSlug(tx, newThreadID, body.Title)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error assigning thread slug:", err)
+			return
+		}
+
+		var statements []statement
+		if len(comments) > 1 {
+			ids := []any{newThreadID}
+			for _, c := range comments[1:] {
+				ids = append(ids, c.id)
+			}
+			in := placeholders(len(comments) - 1)
+			statements = append(statements,
+				statement{"UPDATE COMMENTS SET thread_id = ? WHERE id IN (" + in + ")", ids},
+				statement{"UPDATE NOTIFICATIONS SET thread_id = ? WHERE comment_id IN (" + in + ")", ids},
+			)
+		}
+
+		// Comments whose parent stays behind or becomes the opening post are
+		// now top level, their replies move up by as many levels
+		for _, c := range comments[1:] {
+			if c.parentID.Valid && moved[c.parentID.Int64] && c.parentID.Int64 != opening.id {
+				continue
+			}
+			ownSegment := len(c.path) - 19
+			statements = append(statements,
+				statement{"UPDATE COMMENTS SET path = SUBSTRING(path, ?), depth = depth - ? WHERE thread_id = ? AND (path = ? OR path LIKE ?)",
+					[]any{ownSegment, c.depth, newThreadID, c.path, c.path + "/%"}},
+				statement{"UPDATE COMMENTS SET parent_id = NULL WHERE id = ?", []any{c.id}},
+			)
+		}
+
+		// What belonged to the opening comment now belongs to the new thread
+		statements = append(statements, []statement{
+			{"INSERT IGNORE INTO THREAD_REACTIONS (user_id, thread_id, reaction, created_at) SELECT user_id, ?, reaction, created_at FROM COMMENT_REACTIONS WHERE comment_id = ?", []any{newThreadID, opening.id}},
+			{"UPDATE BOOKMARKS SET thread_id = ?, comment_id = NULL WHERE comment_id = ?", []any{newThreadID, opening.id}},
+			{"UPDATE ATTACHMENTS SET thread_id = ?, comment_id = NULL WHERE comment_id = ?", []any{newThreadID, opening.id}},
+			{"UPDATE MENTIONS SET thread_id = ?, comment_id = NULL WHERE comment_id = ?", []any{newThreadID, opening.id}},
+			{"UPDATE NOTIFICATIONS SET thread_id = ?, comment_id = NULL WHERE comment_id = ?", []any{newThreadID, opening.id}},
+			// An accepted answer that moved is no answer to the old thread
+			{"UPDATE THREADS SET accepted_comment_id = NULL WHERE id = ? AND accepted_comment_id IN (SELECT id FROM COMMENTS WHERE thread_id = ?)", []any{threadID, newThreadID}},
+			{"DELETE FROM COMMENTS WHERE id = ?", []any{opening.id}},
+		}...)
+		if err := execAll(tx, statements); err != nil {
+			http.Error(w, "Failed to split thread", http.StatusInternalServerError)
+			log.Println("Error splitting thread:", err)
+			return
+		}
+
+		details := ModerationDetails{}
+		for _, c := range comments {
+			details.CommentIDs = append(details.CommentIDs, c.id)
+		}
+		if err := recordModeration(tx, user, "split", int64(threadID), &newThreadID, details, body.Reason); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error recording moderation:", err)
+			return
+		}
+
+		notified := make(map[string]bool)
+		for _, c := range comments {
+			if notified[c.author] {
+				continue
+			}
+			notified[c.author] = true
+
+			err := notifyModeration(tx, c.author, Notification{
+				Type:                NotificationModeration,
+				Actor:               user,
+				ThreadID:            &newThreadID,
+				NotificationDetails: NotificationDetails{Action: "split", Reason: body.Reason},
+			})
+			if err != nil {
+				http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+				log.Println("Error creating moderation notification:", err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		for author := range notified {
+			if err := subscribeToThread(db, newThreadID, author); err != nil {
+				log.Println("Error subscribing author to thread:", err)
+			}
+		}
+		threadPublished(db, newThreadID, opening.author)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ThreadSplitResponse{ThreadID: newThreadID, Slug: slug}); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("%d comments split from thread %d into thread %d by %s", len(comments), threadID, newThreadID, user)
+	}
+}
+
+// MoveThreadHandler moves a thread to another category
+func MoveThreadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for MoveThread")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+
+		var body ThreadMove
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		author, fromCategoryID, err := lockThread(tx, threadID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error locking thread:", err)
+			return
+		}
+
+		var categoryID int
+		err = tx.QueryRow("SELECT id FROM CATEGORIES WHERE category = ?", body.Category).Scan(&categoryID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invalid category", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get category ID", http.StatusInternalServerError)
+			log.Println("Error getting category ID from database:", err)
+			return
+		}
+
+		details := ModerationDetails{ToCategory: body.Category}
+		if fromCategoryID.Valid {
+			err = tx.QueryRow("SELECT category FROM CATEGORIES WHERE id = ?", fromCategoryID.Int64).Scan(&details.FromCategory)
+			if err != nil {
+				http.Error(w, "Failed to find category", http.StatusInternalServerError)
+				log.Println("Error querying database:", err)
+				return
+			}
+		}
+
+		if _, err := tx.Exec("UPDATE THREADS SET category_id = ? WHERE id = ?", categoryID, threadID); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		if err := recordModeration(tx, user, "move", int64(threadID), nil, details, body.Reason); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error recording moderation:", err)
+			return
+		}
+
+		thread := int64(threadID)
+		err = notifyModeration(tx, author, Notification{
+			Type:                NotificationModeration,
+			Actor:               user,
+			ThreadID:            &thread,
+			NotificationDetails: NotificationDetails{Action: "move", Reason: body.Reason},
+		})
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error creating moderation notification:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		invalidateThreadIndex()
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Thread %d moved to %s by %s", threadID, body.Category, user)
+	}
+}
+
+// GetModerationLogHandler returns the moderation audit trail, newest first.
+// Supports ?limit=, ?cursor= (the next_cursor of the previous page) and
+// ?thread_id= to only show actions on one thread.
+func GetModerationLogHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetModerationLog")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		params := r.URL.Query()
+		limit := 20
+		if limitStr := params.Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		query := "SELECT id, moderator, action, thread_id, target_thread_id, details, reason, created_at FROM MODERATION_LOG WHERE TRUE"
+		var args []any
+		if cursorStr := params.Get("cursor"); cursorStr != "" {
+			cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			query += " AND id < ?"
+			args = append(args, cursor)
+		}
+		if threadStr := params.Get("thread_id"); threadStr != "" {
+			threadID, err := strconv.Atoi(threadStr)
+			if err != nil {
+				http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+				return
+			}
+			query += " AND (thread_id = ? OR target_thread_id = ?)"
+			args = append(args, threadID, threadID)
+		}
+		query += " ORDER BY id DESC LIMIT ?"
+		args = append(args, limit+1)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		response := ModerationLogListGet{Entries: []ModerationLogGet{}}
+		for rows.Next() {
+			var entry ModerationLogGet
+			var targetThreadID sql.NullInt64
+			var details string
+			var createdAt time.Time
+			if err := rows.Scan(&entry.ID, &entry.Moderator, &entry.Action, &entry.ThreadID, &targetThreadID, &details, &entry.Reason, &createdAt); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			if targetThreadID.Valid {
+				target := int(targetThreadID.Int64)
+				entry.TargetThreadID = &target
+			}
+			if err := json.Unmarshal([]byte(details), &entry.Details); err != nil {
+				log.Println("Error decoding moderation details:", err)
+			}
+			entry.Time = createdAt.Format(time.RFC3339)
+			response.Entries = append(response.Entries, entry)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		if len(response.Entries) > limit {
+			response.Entries = response.Entries[:limit]
+			next := response.Entries[limit-1].ID
+			response.NextCursor = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Println("Successfully fetched moderation log")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"web-forum/storage"
+	"web-forum/utils"
 
 	"github.com/gorilla/mux"
 )
@@ -13,6 +15,10 @@ import (
 type CommentCreate struct {
 	Content string `json:"content"`
 	Author  string `json:"author"`
+	// ParentID is the comment being replied to, only used when creating
+	ParentID *int64 `json:"parent_id,omitempty"`
+	// Quotes replace the quotes of an edited comment unless omitted
+	Quotes []QuoteCreate `json:"quotes,omitempty"`
 }
 
 // CreateCommentHandler creates a new comment in the database
@@ -44,28 +50,119 @@ func CreateCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// The author is whoever is logged in, not what the body claims
+		user := r.Context().Value("user").(string)
+
 		if body.Content == "" {
 			http.Error(w, "Content is required.", http.StatusBadRequest)
 			log.Println("Content is required.")
 			return
 		}
 
-		query := "INSERT INTO COMMENTS (content, author, thread_id) VALUES (?, ?, ?)"
-		_, err = db.Exec(query, body.Content, body.Author, threadID)
+		if len(body.Quotes) > maxQuotes {
+			http.Error(w, "Too many quotes", http.StatusBadRequest)
+			log.Println("Too many quotes")
+			return
+		}
+
+		published, err := threadIsPublished(db, threadID)
+		if err != nil {
+			http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+			log.Println("Error getting thread from database:", err)
+			return
+		}
+		if !published {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			log.Println("Thread not found:", threadID)
+			return
+		}
+
+		contentHTML, err := utils.RenderMarkdown(body.Content)
+		if err != nil {
+			http.Error(w, "Failed to render content", http.StatusInternalServerError)
+			log.Println("Error rendering markdown:", err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		var parentPath string
+		depth := 0
+		if body.ParentID != nil {
+			parentPath, depth, err = commentParent(tx, threadID, *body.ParentID)
+			if err == errParentNotFound || err == errReplyTooDeep {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				log.Println("Invalid parent comment:", err)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to get parent comment", http.StatusInternalServerError)
+				log.Println("Error getting parent comment from database:", err)
+				return
+			}
+			depth++
+		}
+
+		quotes, err := resolveQuotes(tx, threadID, body.Quotes)
+		if err == errQuoteNotFound || err == errInvalidQuote {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Println("Invalid quote:", err)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get quoted comment", http.StatusInternalServerError)
+			log.Println("Error getting quoted comment from database:", err)
+			return
+		}
+
+		query := "INSERT INTO COMMENTS (content, content_html, author, thread_id, parent_id, depth) VALUES (?, ?, ?, ?, ?, ?)"
+		result, err := tx.Exec(query, body.Content, contentHTML, user, threadID, body.ParentID, depth)
 		if err != nil {
 			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
 			log.Println("Error inserting data into database:", err)
 			return
 		}
 
+		commentID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error getting comment ID:", err)
+			return
+		}
+
+		if err := setCommentPath(tx, commentID, parentPath); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error setting comment path:", err)
+			return
+		}
+
+		if err := saveQuotes(tx, commentID, quotes); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error saving quotes:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		commentCreated(db, int64(threadID), commentID, user, body.Content)
+
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully submitted"}`))
 		log.Println("Thread created successfully")
 	}
 }
 
-// DeleteCommentHandler deletes a comment from the database
-func DeleteCommentHandler(db *sql.DB) http.HandlerFunc {
+// DeleteCommentHandler deletes a comment from the database, leaving a
+// tombstone if other comments reply to or quote it
+func DeleteCommentHandler(db *sql.DB, store storage.BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		idStr := vars["id"]
@@ -93,14 +190,45 @@ func DeleteCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "DELETE FROM COMMENTS WHERE id=? AND author=?"
-		_, err = db.Exec(query, commentId, user)
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		var author string
+		query := "SELECT author FROM COMMENTS WHERE id=? AND deleted_at IS NULL FOR UPDATE"
+		err = tx.QueryRow(query, commentId).Scan(&author)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get author", http.StatusInternalServerError)
+			log.Println("Error getting author from database:", err)
+			return
+		}
+
+		if user != author {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		attachments, err := deleteComment(tx, int64(commentId), deletedByAuthor)
 		if err != nil {
 			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
 			log.Println("Error deleting data from database:", err)
 			return
 		}
 
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+		deleteBlobs(r.Context(), store, attachments)
+
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully deleted"}`))
 		log.Println("Thread deleted successfully")
@@ -132,9 +260,10 @@ func UpdateCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		userQuery := "SELECT author FROM COMMENTS WHERE id=?"
+		userQuery := "SELECT author, thread_id FROM COMMENTS WHERE id=?"
 		var author string
-		err = db.QueryRow(userQuery, commentID).Scan(&author)
+		var threadID int64
+		err = db.QueryRow(userQuery, commentID).Scan(&author, &threadID)
 		if err != nil {
 			http.Error(w, "Failed to get author", http.StatusInternalServerError)
 			log.Println("Error getting author from database:", err)
@@ -159,14 +288,70 @@ func UpdateCommentHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "UPDATE COMMENTS SET content=? WHERE id=?"
-		_, err = db.Exec(query, body.Content, commentID)
+		if len(body.Quotes) > maxQuotes {
+			http.Error(w, "Too many quotes", http.StatusBadRequest)
+			log.Println("Too many quotes")
+			return
+		}
+
+		contentHTML, err := utils.RenderMarkdown(body.Content)
+		if err != nil {
+			http.Error(w, "Failed to render content", http.StatusInternalServerError)
+			log.Println("Error rendering markdown:", err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		if err := recordCommentRevision(tx, commentID, body.Content); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error recording comment revision:", err)
+			return
+		}
+
+		query := "UPDATE COMMENTS SET content=?, content_html=? WHERE id=?"
+		_, err = tx.Exec(query, body.Content, contentHTML, commentID)
 		if err != nil {
 			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
 			log.Println("Error inserting data into database:", err)
 			return
 		}
 
+		if body.Quotes != nil {
+			quotes, err := resolveQuotes(tx, int(threadID), body.Quotes)
+			if err == errQuoteNotFound || err == errInvalidQuote {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				log.Println("Invalid quote:", err)
+				return
+			} else if err != nil {
+				http.Error(w, "Failed to get quoted comment", http.StatusInternalServerError)
+				log.Println("Error getting quoted comment from database:", err)
+				return
+			}
+
+			if err := saveQuotes(tx, int64(commentID), quotes); err != nil {
+				http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+				log.Println("Error saving quotes:", err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		if err := syncMentions(db, "comment_id", int64(commentID), threadID, author, body.Content); err != nil {
+			log.Println("Error recording comment mentions:", err)
+		}
+
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully submitted"}`))
 		log.Println("Thread created successfully")
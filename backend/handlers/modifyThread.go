@@ -6,15 +6,34 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"time"
+	"web-forum/storage"
+	"web-forum/utils"
 
 	"github.com/gorilla/mux"
 )
 
 type ThreadCreate struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Author      string `json:"author"`
-	Category    string `json:"category"`
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Author      string      `json:"author"`
+	Category    string      `json:"category"`
+	PublishAt   string      `json:"publish_at,omitempty"`
+	Poll        *PollCreate `json:"poll,omitempty"`
+	// QAMode overrides the Q&A mode of the category, kept as it is on updates if omitted
+	QAMode *bool `json:"qa_mode,omitempty"`
+	// Force skips the check for similar threads
+	Force bool `json:"force"`
+}
+
+// ThreadCreateResponse is the response to creating a thread. Similar lists
+// existing threads the new one may duplicate, so clients can point them out.
+// SimilarCheckFailed is set when the check could not run, so an empty Similar
+// does not mean there were none.
+type ThreadCreateResponse struct {
+	Message            string             `json:"message"`
+	Similar            []RelatedThreadGet `json:"similar,omitempty"`
+	SimilarCheckFailed bool               `json:"similar_check_failed,omitempty"`
 }
 
 // CreateThreadHandler handles the creation of a new Thread
@@ -35,6 +54,9 @@ func CreateThreadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		// The author is whoever is logged in, not what the body claims
+		user := r.Context().Value("user").(string)
+
 		if body.Title == "" || body.Description == "" {
 			http.Error(w, "Title and Description are required", http.StatusBadRequest)
 			log.Println("Title or Description is missing")
@@ -47,30 +69,126 @@ func CreateThreadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		descriptionHTML, err := utils.RenderMarkdown(body.Description)
+		if err != nil {
+			http.Error(w, "Failed to render description", http.StatusInternalServerError)
+			log.Println("Error rendering markdown:", err)
+			return
+		}
+
 		var categoryID int
-		err := db.QueryRow("SELECT id FROM CATEGORIES WHERE category=?", body.Category).Scan(&categoryID)
+		err = db.QueryRow("SELECT id FROM CATEGORIES WHERE category=?", body.Category).Scan(&categoryID)
 		if err != nil {
 			http.Error(w, "Failed to get category ID", http.StatusInternalServerError)
 			log.Println("Error getting category ID from database:", err)
 			return
 		}
 
-		query := "INSERT INTO THREADS (title, description, author, category_id) VALUES (?, ?, ?, ?)"
-		_, err = db.Exec(query, body.Title, body.Description, body.Author, categoryID)
+		// Threads with a publish time stay hidden until the scheduler publishes them
+		var publishAt sql.NullTime
+		if body.PublishAt != "" {
+			t, err := time.Parse(time.RFC3339, body.PublishAt)
+			if err != nil {
+				http.Error(w, "Invalid publish_at, expected RFC3339 timestamp", http.StatusBadRequest)
+				log.Println("Invalid publish_at:", err)
+				return
+			}
+
+			if !t.After(time.Now()) {
+				http.Error(w, "publish_at must be in the future", http.StatusBadRequest)
+				log.Println("publish_at is in the past")
+				return
+			}
+			publishAt = sql.NullTime{Time: t.UTC(), Valid: true}
+		}
+
+		// Likely duplicates are only pointed out, the thread is created anyway
+		var similar []RelatedThreadGet
+		similarCheckFailed := false
+		if !body.Force {
+			similar, err = findSimilarThreads(db, body.Title, body.Description, body.Category)
+			if err != nil {
+				similarCheckFailed = true
+				log.Println("Error finding similar threads:", err)
+			}
+		}
+
+		if body.Poll != nil {
+			if err := validatePoll(body.Poll); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				log.Println("Invalid poll:", err)
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		query := "INSERT INTO THREADS (title, description, description_html, author, category_id, publish_at, published, qa_mode) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+		result, err := tx.Exec(query, body.Title, body.Description, descriptionHTML, user, categoryID, publishAt, !publishAt.Valid, body.QAMode)
 		if err != nil {
 			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
 			log.Println("Error inserting data into database:", err)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"message":"Data successfully submitted"}`))
-		log.Println("Thread created successfully")
+		threadID, err := result.LastInsertId()
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error getting thread ID:", err)
+			return
+		}
+
+		if _, err := assignThreadSlug(tx, threadID, body.Title); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error assigning thread slug:", err)
+			return
+		}
+
+		if body.Poll != nil {
+			if err := createPoll(tx, threadID, body.Poll); err != nil {
+				http.Error(w, "Failed to create poll", http.StatusInternalServerError)
+				log.Println("Error creating poll:", err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		response := ThreadCreateResponse{Message: "Data successfully submitted", Similar: similar, SimilarCheckFailed: similarCheckFailed}
+		if publishAt.Valid {
+			response.Message = "Thread scheduled for publishing"
+		} else {
+			threadPublished(db, threadID, user)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			log.Println("Error encoding JSON:", err)
+		}
+
+		if publishAt.Valid {
+			log.Printf("Thread scheduled for %s", publishAt.Time.Format(time.RFC3339))
+		} else {
+			log.Println("Thread created successfully")
+		}
+		if len(similar) > 0 {
+			log.Printf("Thread %d looks similar to %d existing threads", threadID, len(similar))
+		}
 	}
 }
 
 // DeleteThreadHandler handles the deletion of a Thread
-func DeleteThreadHandler(db *sql.DB) http.HandlerFunc {
+func DeleteThreadHandler(db *sql.DB, store storage.BlobStore) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
 		idStr := vars["id"]
@@ -98,13 +216,42 @@ func DeleteThreadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		// The attachment rows of the thread and its comments go with it by
+		// their foreign keys, the files have to be removed from storage
+		attachments, err := threadAttachmentKeys(tx, threadID)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
 		query := "DELETE FROM THREADS WHERE id=? AND author=?"
-		_, err = db.Exec(query, threadID, user)
+		result, err := tx.Exec(query, threadID, user)
 		if err != nil {
 			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
 			log.Println("Error deleting data from database:", err)
 			return
 		}
+		if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+			attachments = nil
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+		deleteBlobs(r.Context(), store, attachments)
+
+		invalidateThreadIndex()
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully deleted"}`))
@@ -170,6 +317,13 @@ func UpdateThreadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		descriptionHTML, err := utils.RenderMarkdown(body.Description)
+		if err != nil {
+			http.Error(w, "Failed to render description", http.StatusInternalServerError)
+			log.Println("Error rendering markdown:", err)
+			return
+		}
+
 		var categoryID int
 		err = db.QueryRow("SELECT id FROM CATEGORIES WHERE category=?", body.Category).Scan(&categoryID)
 		if err != nil {
@@ -178,14 +332,62 @@ func UpdateThreadHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		query := "UPDATE THREADS SET title=?, description=?, category_id=? WHERE id=?"
-		_, err = db.Exec(query, body.Title, body.Description, categoryID, threadID)
+		tx, err := db.Begin()
 		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		query := "UPDATE THREADS SET title=?, description=?, description_html=?, category_id=? WHERE id=?"
+		_, err = tx.Exec(query, body.Title, body.Description, descriptionHTML, categoryID, threadID)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		if body.QAMode != nil {
+			if _, err := tx.Exec("UPDATE THREADS SET qa_mode=? WHERE id=?", *body.QAMode, threadID); err != nil {
+				http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+				log.Println("Error inserting data into database:", err)
+				return
+			}
+		}
+
+		// Turning Q&A mode off, or moving to a category without it, drops the accepted answer
+		query = `
+    UPDATE THREADS t JOIN CATEGORIES c ON c.id = t.category_id
+    SET t.accepted_comment_id = NULL
+    WHERE t.id = ? AND NOT ` + qaModeColumn
+		if _, err := tx.Exec(query, threadID); err != nil {
 			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
 			log.Println("Error inserting data into database:", err)
 			return
 		}
 
+		// The old slug keeps pointing at the thread
+		if _, err := assignThreadSlug(tx, int64(threadID), body.Title); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error assigning thread slug:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		// Scheduled threads get their mentions once they are published
+		if published, err := threadIsPublished(db, threadID); err != nil {
+			log.Println("Error getting thread from database:", err)
+		} else if published {
+			threadMentionsChanged(db, int64(threadID))
+		}
+		invalidateThreadIndex()
+
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message":"Data successfully submitted"}`))
 		log.Println("Thread created successfully")
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type NotificationType string
+
+const (
+	NotificationReply      NotificationType = "reply"
+	NotificationMention    NotificationType = "mention"
+	NotificationReaction   NotificationType = "reaction"
+	NotificationModeration NotificationType = "moderation"
+)
+
+// NotificationDetails holds the fields that only some notification types use.
+// They are stored as JSON in the details column.
+type NotificationDetails struct {
+	// Reaction is the reaction given, for reaction notifications
+	Reaction string `json:"reaction,omitempty"`
+	// Action and Reason describe what a moderator did and why
+	Action string `json:"action,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Excerpt is a short preview of the text that caused the notification
+	Excerpt string `json:"excerpt,omitempty"`
+}
+
+// Notification is the payload features emit for a user
+type Notification struct {
+	Type      NotificationType `json:"type"`
+	Actor     string           `json:"actor"`
+	ThreadID  *int64           `json:"thread_id"`
+	CommentID *int64           `json:"comment_id"`
+	NotificationDetails
+}
+
+type NotificationGet struct {
+	ID int64 `json:"id"`
+	Notification
+	Read bool   `json:"read"`
+	Time string `json:"time"`
+}
+
+type NotificationListGet struct {
+	Notifications []NotificationGet `json:"notifications"`
+	NextCursor    *int64            `json:"next_cursor"`
+}
+
+type UnreadCountGet struct {
+	Unread int `json:"unread"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx so notifications can be
+// emitted inside a feature's transaction
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// emitNotification stores a notification for a user. Users are never notified
+// about their own actions.
+func emitNotification(db execer, userID int, n Notification) error {
+	var details sql.NullString
+	if n.NotificationDetails != (NotificationDetails{}) {
+		encoded, err := json.Marshal(n.NotificationDetails)
+		if err != nil {
+			return err
+		}
+		details = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	query := `
+    INSERT INTO NOTIFICATIONS (user_id, type, actor, thread_id, comment_id, details)
+    SELECT id, ?, ?, ?, ?, ? FROM USERS WHERE id = ? AND username <> ?`
+	_, err := db.Exec(query, n.Type, n.Actor, n.ThreadID, n.CommentID, details, userID, n.Actor)
+	return err
+}
+
+// excerpt shortens text for use in a notification preview
+func excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= 100 {
+		return text
+	}
+	return string(runes[:100]) + "…"
+}
+
+// notifyThreadReaction tells the author of a thread that someone reacted to it
+func notifyThreadReaction(db *sql.DB, threadID int, actor string, reaction string) {
+	var authorID int
+	query := "SELECT u.id FROM THREADS t JOIN USERS u ON u.username = t.author WHERE t.id = ?"
+	if err := db.QueryRow(query, threadID).Scan(&authorID); err != nil {
+		log.Println("Error getting thread author:", err)
+		return
+	}
+
+	thread := int64(threadID)
+	err := emitNotification(db, authorID, Notification{
+		Type:                NotificationReaction,
+		Actor:               actor,
+		ThreadID:            &thread,
+		NotificationDetails: NotificationDetails{Reaction: reaction},
+	})
+	if err != nil {
+		log.Println("Error creating reaction notification:", err)
+	}
+}
+
+// notifyCommentReaction tells the author of a comment that someone reacted to it
+func notifyCommentReaction(db *sql.DB, commentID int, actor string, reaction string) {
+	var authorID int
+	var threadID int64
+	query := "SELECT u.id, c.thread_id FROM COMMENTS c JOIN USERS u ON u.username = c.author WHERE c.id = ?"
+	if err := db.QueryRow(query, commentID).Scan(&authorID, &threadID); err != nil {
+		log.Println("Error getting comment author:", err)
+		return
+	}
+
+	comment := int64(commentID)
+	err := emitNotification(db, authorID, Notification{
+		Type:                NotificationReaction,
+		Actor:               actor,
+		ThreadID:            &threadID,
+		CommentID:           &comment,
+		NotificationDetails: NotificationDetails{Reaction: reaction},
+	})
+	if err != nil {
+		log.Println("Error creating reaction notification:", err)
+	}
+}
+
+// GetNotificationsHandler returns the logged in user's notifications, newest
+// first. Supports ?limit=, ?cursor= (the next_cursor of the previous page) and
+// ?unread=true.
+func GetNotificationsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetNotifications")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		params := r.URL.Query()
+		limit := 20
+		if limitStr := params.Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 100 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		query := `
+    SELECT n.id, n.type, n.actor, n.thread_id, n.comment_id, n.details, n.is_read, n.created_at
+    FROM NOTIFICATIONS n
+    JOIN USERS u ON u.id = n.user_id
+    WHERE u.username = ?`
+		args := []any{user}
+		if cursorStr := params.Get("cursor"); cursorStr != "" {
+			cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid cursor", http.StatusBadRequest)
+				return
+			}
+			query += " AND n.id < ?"
+			args = append(args, cursor)
+		}
+		if params.Get("unread") == "true" {
+			query += " AND n.is_read = FALSE"
+		}
+		// Fetch one extra row to know whether there is another page
+		query += " ORDER BY n.id DESC LIMIT ?"
+		args = append(args, limit+1)
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		response := NotificationListGet{Notifications: []NotificationGet{}}
+		for rows.Next() {
+			var notification NotificationGet
+			var threadID, commentID sql.NullInt64
+			var details sql.NullString
+			var createdAt time.Time
+			if err := rows.Scan(&notification.ID, &notification.Type, &notification.Actor, &threadID, &commentID, &details, &notification.Read, &createdAt); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			if threadID.Valid {
+				notification.ThreadID = &threadID.Int64
+			}
+			if commentID.Valid {
+				notification.CommentID = &commentID.Int64
+			}
+			if details.Valid {
+				if err := json.Unmarshal([]byte(details.String), &notification.NotificationDetails); err != nil {
+					log.Println("Error decoding notification details:", err)
+				}
+			}
+			notification.Time = createdAt.Format(time.RFC3339)
+			response.Notifications = append(response.Notifications, notification)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		if len(response.Notifications) > limit {
+			response.Notifications = response.Notifications[:limit]
+			next := response.Notifications[limit-1].ID
+			response.NextCursor = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched notifications for user %s", user)
+	}
+}
+
+// GetUnreadNotificationCountHandler returns how many unread notifications the
+// logged in user has
+func GetUnreadNotificationCountHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetUnreadNotificationCount")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var count UnreadCountGet
+		query := "SELECT COUNT(*) FROM NOTIFICATIONS n JOIN USERS u ON u.id = n.user_id WHERE u.username = ? AND n.is_read = FALSE"
+		if err := db.QueryRow(query, user).Scan(&count.Unread); err != nil {
+			http.Error(w, "Failed to parse database row", http.StatusInternalServerError)
+			log.Println("Error parsing database row:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(count); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched unread notification count for user %s", user)
+	}
+}
+
+// MarkNotificationReadHandler marks one notification of the logged in user as read
+func MarkNotificationReadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for MarkNotificationRead")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+			log.Println("Invalid notification ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := "UPDATE NOTIFICATIONS n JOIN USERS u ON u.id = n.user_id SET n.is_read = TRUE WHERE n.id = ? AND u.username = ?"
+		if _, err := db.Exec(query, id, user); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Notification %d marked as read", id)
+	}
+}
+
+// MarkAllNotificationsReadHandler marks every notification of the logged in user as read
+func MarkAllNotificationsReadHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for MarkAllNotificationsRead")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := "UPDATE NOTIFICATIONS n JOIN USERS u ON u.id = n.user_id SET n.is_read = TRUE WHERE u.username = ? AND n.is_read = FALSE"
+		if _, err := db.Exec(query, user); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("All notifications of user %s marked as read", user)
+	}
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type PollCreate struct {
+	Question       string   `json:"question"`
+	Options        []string `json:"options"`
+	MultipleChoice bool     `json:"multiple_choice"`
+	PublicVotes    bool     `json:"public_votes"`
+	ClosesAt       string   `json:"closes_at,omitempty"`
+}
+
+type PollOptionGet struct {
+	ID     int      `json:"id"`
+	Text   string   `json:"text"`
+	Votes  int      `json:"votes"`
+	Voters []string `json:"voters,omitempty"`
+}
+
+type PollGet struct {
+	ID             int             `json:"id"`
+	Question       string          `json:"question"`
+	MultipleChoice bool            `json:"multiple_choice"`
+	PublicVotes    bool            `json:"public_votes"`
+	ClosesAt       *string         `json:"closes_at"`
+	Closed         bool            `json:"closed"`
+	TotalVoters    int             `json:"total_voters"`
+	Options        []PollOptionGet `json:"options"`
+}
+
+type PollVoteCreate struct {
+	OptionIDs []int `json:"option_ids"`
+}
+
+func validatePoll(poll *PollCreate) error {
+	if len(poll.Question) > 255 {
+		return fmt.Errorf("Poll question is too long")
+	}
+
+	if len(poll.Options) < 2 || len(poll.Options) > 10 {
+		return fmt.Errorf("Poll must have between 2 and 10 options")
+	}
+
+	for i, option := range poll.Options {
+		poll.Options[i] = strings.TrimSpace(option)
+		if poll.Options[i] == "" {
+			return fmt.Errorf("Poll options must not be empty")
+		}
+		if len(poll.Options[i]) > 255 {
+			return fmt.Errorf("Poll option is too long")
+		}
+	}
+
+	if poll.ClosesAt != "" {
+		closesAt, err := time.Parse(time.RFC3339, poll.ClosesAt)
+		if err != nil {
+			return fmt.Errorf("Invalid closes_at, expected RFC3339 timestamp")
+		}
+		if !closesAt.After(time.Now()) {
+			return fmt.Errorf("closes_at must be in the future")
+		}
+	}
+
+	return nil
+}
+
+// createPoll inserts a validated poll for a thread as part of the thread's
+// creation transaction
+func createPoll(tx *sql.Tx, threadID int64, poll *PollCreate) error {
+	var closesAt sql.NullTime
+	if poll.ClosesAt != "" {
+		t, err := time.Parse(time.RFC3339, poll.ClosesAt)
+		if err != nil {
+			return err
+		}
+		closesAt = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+
+	query := "INSERT INTO POLLS (thread_id, question, multiple_choice, public_votes, closes_at) VALUES (?, ?, ?, ?, ?)"
+	result, err := tx.Exec(query, threadID, poll.Question, poll.MultipleChoice, poll.PublicVotes, closesAt)
+	if err != nil {
+		return err
+	}
+
+	pollID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for i, option := range poll.Options {
+		_, err := tx.Exec("INSERT INTO POLL_OPTIONS (poll_id, position, text) VALUES (?, ?, ?)", pollID, i, option)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadPoll returns the poll of a thread with its current tallies, or nil if the
+// thread has no poll
+func loadPoll(db *sql.DB, threadID int) (*PollGet, error) {
+	var poll PollGet
+	var closesAt sql.NullTime
+	query := "SELECT id, question, multiple_choice, public_votes, closes_at FROM POLLS WHERE thread_id=?"
+	err := db.QueryRow(query, threadID).Scan(&poll.ID, &poll.Question, &poll.MultipleChoice, &poll.PublicVotes, &closesAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if closesAt.Valid {
+		formatted := closesAt.Time.Format(time.RFC3339)
+		poll.ClosesAt = &formatted
+		poll.Closed = !time.Now().Before(closesAt.Time)
+	}
+
+	query = `
+    SELECT o.id, o.text, COUNT(v.user_id)
+    FROM POLL_OPTIONS o
+    LEFT JOIN POLL_VOTES v ON v.option_id = o.id
+    WHERE o.poll_id = ?
+    GROUP BY o.id, o.text, o.position
+    ORDER BY o.position`
+	rows, err := db.Query(query, poll.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	optionIndex := make(map[int]int)
+	for rows.Next() {
+		var option PollOptionGet
+		if err := rows.Scan(&option.ID, &option.Text, &option.Votes); err != nil {
+			return nil, err
+		}
+		optionIndex[option.ID] = len(poll.Options)
+		poll.Options = append(poll.Options, option)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow("SELECT COUNT(DISTINCT user_id) FROM POLL_VOTES WHERE poll_id=?", poll.ID).Scan(&poll.TotalVoters)
+	if err != nil {
+		return nil, err
+	}
+
+	if poll.PublicVotes {
+		query = `
+    SELECT v.option_id, u.username
+    FROM POLL_VOTES v
+    JOIN USERS u ON u.id = v.user_id
+    WHERE v.poll_id = ?
+    ORDER BY v.created_at`
+		voterRows, err := db.Query(query, poll.ID)
+		if err != nil {
+			return nil, err
+		}
+		defer voterRows.Close()
+
+		for voterRows.Next() {
+			var optionID int
+			var username string
+			if err := voterRows.Scan(&optionID, &username); err != nil {
+				return nil, err
+			}
+			if i, ok := optionIndex[optionID]; ok {
+				poll.Options[i].Voters = append(poll.Options[i].Voters, username)
+			}
+		}
+		if err := voterRows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &poll, nil
+}
+
+// openPollForThread looks up the poll of a published thread and reports an
+// HTTP error if there is none or it no longer accepts votes
+func openPollForThread(w http.ResponseWriter, db *sql.DB, threadID int) (pollID int, multipleChoice bool, ok bool) {
+	var closesAt sql.NullTime
+	query := `
+    SELECT p.id, p.multiple_choice, p.closes_at
+    FROM POLLS p
+    JOIN THREADS t ON t.id = p.thread_id
+    WHERE p.thread_id = ? AND t.published = TRUE`
+	err := db.QueryRow(query, threadID).Scan(&pollID, &multipleChoice, &closesAt)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Poll not found", http.StatusNotFound)
+		return 0, false, false
+	} else if err != nil {
+		http.Error(w, "Failed to get poll", http.StatusInternalServerError)
+		log.Println("Error getting poll from database:", err)
+		return 0, false, false
+	}
+
+	if closesAt.Valid && !time.Now().Before(closesAt.Time) {
+		http.Error(w, "Poll is closed", http.StatusForbidden)
+		return 0, false, false
+	}
+
+	return pollID, multipleChoice, true
+}
+
+func writePoll(w http.ResponseWriter, db *sql.DB, threadID int) {
+	poll, err := loadPoll(db, threadID)
+	if err != nil {
+		http.Error(w, "Failed to get poll", http.StatusInternalServerError)
+		log.Println("Error getting poll from database:", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(poll); err != nil {
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		log.Println("Error encoding JSON:", err)
+	}
+}
+
+// VotePollHandler records the logged in user's vote on a thread's poll. On a
+// single choice poll a new vote replaces the previous one.
+func VotePollHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for VotePoll")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var user_id int
+		err = db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		if err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		var body PollVoteCreate
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		pollID, multipleChoice, ok := openPollForThread(w, db, threadID)
+		if !ok {
+			return
+		}
+
+		if len(body.OptionIDs) == 0 || (!multipleChoice && len(body.OptionIDs) > 1) {
+			http.Error(w, "Invalid number of options", http.StatusBadRequest)
+			log.Println("Invalid number of options")
+			return
+		}
+
+		for _, optionID := range body.OptionIDs {
+			var exists bool
+			err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM POLL_OPTIONS WHERE id=? AND poll_id=?)", optionID, pollID).Scan(&exists)
+			if err != nil {
+				http.Error(w, "Failed to query database", http.StatusInternalServerError)
+				log.Println("Error querying database:", err)
+				return
+			}
+			if !exists {
+				http.Error(w, "Invalid option", http.StatusBadRequest)
+				log.Println("Invalid option:", optionID)
+				return
+			}
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		var singleChoicePollID sql.NullInt64
+		if !multipleChoice {
+			singleChoicePollID = sql.NullInt64{Int64: int64(pollID), Valid: true}
+			if _, err := tx.Exec("DELETE FROM POLL_VOTES WHERE poll_id=? AND user_id=?", pollID, user_id); err != nil {
+				http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+				log.Println("Error deleting previous vote:", err)
+				return
+			}
+		}
+
+		query := "INSERT IGNORE INTO POLL_VOTES (option_id, user_id, poll_id, single_choice_poll_id) VALUES (?, ?, ?, ?)"
+		for _, optionID := range body.OptionIDs {
+			if _, err := tx.Exec(query, optionID, user_id, pollID, singleChoicePollID); err != nil {
+				http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+				log.Println("Error inserting data into database:", err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+
+		writePoll(w, db, threadID)
+		log.Printf("Successfully recorded vote on poll %d by user %s", pollID, user)
+	}
+}
+
+// UnvotePollHandler removes the logged in user's votes from a thread's poll,
+// or only the vote for the option given as ?option_id=
+func UnvotePollHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for UnvotePoll")
+
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var user_id int
+		err = db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		if err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		pollID, _, ok := openPollForThread(w, db, threadID)
+		if !ok {
+			return
+		}
+
+		if optionStr := r.URL.Query().Get("option_id"); optionStr != "" {
+			optionID, err := strconv.Atoi(optionStr)
+			if err != nil {
+				http.Error(w, "Invalid option", http.StatusBadRequest)
+				log.Println("Invalid option:", err)
+				return
+			}
+			_, err = db.Exec("DELETE FROM POLL_VOTES WHERE poll_id=? AND user_id=? AND option_id=?", pollID, user_id, optionID)
+		} else {
+			_, err = db.Exec("DELETE FROM POLL_VOTES WHERE poll_id=? AND user_id=?", pollID, user_id)
+		}
+		if err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting data from database:", err)
+			return
+		}
+
+		writePoll(w, db, threadID)
+		log.Printf("Successfully removed vote on poll %d by user %s", pollID, user)
+	}
+}
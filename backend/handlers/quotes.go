@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"web-forum/utils"
+)
+
+// A comment can quote at most this many passages
+const maxQuotes = 10
+
+var (
+	errQuoteNotFound = errors.New("Quoted comment not found in this thread")
+	errInvalidQuote  = errors.New("Quote range is outside the quoted comment")
+)
+
+// QuoteCreate quotes the part of another comment from Start to End, counted
+// in UTF-16 code units like mention offsets
+type QuoteCreate struct {
+	CommentID int64 `json:"comment_id"`
+	Start     int   `json:"start"`
+	End       int   `json:"end"`
+}
+
+// QuoteGet describes a quoted passage. CommentID is null once the quoted
+// comment is deleted, unless it was kept as a tombstone. Edited is true when
+// the quoted comment was edited after it was quoted. Excerpt is the passage as
+// it was quoted, until the quoted comment is deleted.
+type QuoteGet struct {
+	CommentID *int   `json:"comment_id"`
+	Author    string `json:"author"`
+	Excerpt   string `json:"excerpt"`
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	Edited    bool   `json:"edited"`
+	Deleted   bool   `json:"deleted"`
+}
+
+// quoteSnapshot is a validated quote with the text and author it quotes
+type quoteSnapshot struct {
+	QuoteCreate
+	author string
+	text   string
+}
+
+// resolveQuotes checks that every quote refers to a range of a comment in the
+// thread and returns the quoted passages
+func resolveQuotes(db queryExecer, threadID int, quotes []QuoteCreate) ([]quoteSnapshot, error) {
+	var snapshots []quoteSnapshot
+	for _, quote := range quotes {
+		var quotedThreadID int
+		var author, content string
+		query := "SELECT thread_id, author, content FROM COMMENTS WHERE id = ? AND deleted_at IS NULL"
+		err := db.QueryRow(query, quote.CommentID).Scan(&quotedThreadID, &author, &content)
+		if err == sql.ErrNoRows || (err == nil && quotedThreadID != threadID) {
+			return nil, errQuoteNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		text, ok := utils.UTF16Slice(content, quote.Start, quote.End)
+		if !ok {
+			return nil, errInvalidQuote
+		}
+		snapshots = append(snapshots, quoteSnapshot{QuoteCreate: quote, author: author, text: text})
+	}
+	return snapshots, nil
+}
+
+// saveQuotes replaces the quotes of a comment
+func saveQuotes(tx *sql.Tx, commentID int64, snapshots []quoteSnapshot) error {
+	statements := []statement{{"DELETE FROM COMMENT_QUOTES WHERE comment_id = ?", []any{commentID}}}
+	for _, quote := range snapshots {
+		statements = append(statements, statement{
+			"INSERT INTO COMMENT_QUOTES (comment_id, quoted_comment_id, quoted_author, quoted_text, range_start, range_end) VALUES (?, ?, ?, ?, ?, ?)",
+			[]any{commentID, quote.CommentID, quote.author, quote.text, quote.Start, quote.End},
+		})
+	}
+	return execAll(tx, statements)
+}
+
+// markQuotedComments sets the quotes of comments, in the order they were given
+func markQuotedComments(db *sql.DB, comments []CommentGet) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int)
+	args := make([]any, len(comments))
+	for i, comment := range comments {
+		index[comment.ID] = i
+		args[i] = comment.ID
+		comments[i].Quotes = []QuoteGet{}
+	}
+
+	query := `
+    SELECT q.comment_id, q.quoted_comment_id, q.quoted_author, q.quoted_text, q.range_start, q.range_end, o.content,
+        COALESCE(o.edited_at > q.created_at, FALSE), o.deleted_at IS NOT NULL
+    FROM COMMENT_QUOTES q
+    LEFT JOIN COMMENTS o ON o.id = q.quoted_comment_id
+    WHERE q.comment_id IN (` + placeholders(len(args)) + `)
+    ORDER BY q.id`
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID int
+		var quotedID sql.NullInt64
+		var quotedText string
+		var current sql.NullString
+		var editedSince, tombstone bool
+		var quote QuoteGet
+		err := rows.Scan(&commentID, &quotedID, &quote.Author, &quotedText, &quote.Start, &quote.End, &current, &editedSince, &tombstone)
+		if err != nil {
+			return err
+		}
+
+		quote.Excerpt = excerpt(quotedText)
+		if quotedID.Valid {
+			id := int(quotedID.Int64)
+			quote.CommentID = &id
+		}
+		if !quotedID.Valid || tombstone {
+			quote.Deleted = true
+		} else {
+			// Edits in the grace period are not tracked but can still change the passage
+			text, ok := utils.UTF16Slice(current.String, quote.Start, quote.End)
+			quote.Edited = editedSince || !ok || text != quotedText
+		}
+
+		comment := &comments[index[commentID]]
+		comment.Quotes = append(comment.Quotes, quote)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// A batch can ask for at most this many threads and this many comments
+const maxReactionBatch = 100
+
+type ReactionBatchRequest struct {
+	ThreadIDs  []int `json:"thread_ids"`
+	CommentIDs []int `json:"comment_ids"`
+}
+
+// ReactionSummary counts the reactions to an item along with the reactions
+// of the logged in user, which are empty for anonymous requests
+type ReactionSummary struct {
+	Counts map[string]int `json:"counts"`
+	UserReactionGet
+}
+
+// ReactionBatchGet has a summary for every requested item, keyed by ID
+type ReactionBatchGet struct {
+	Threads  map[int]ReactionSummary `json:"threads"`
+	Comments map[int]ReactionSummary `json:"comments"`
+}
+
+// publishedIDs returns which of the given items are public. Scheduled
+// threads and their comments are not.
+func publishedIDs(db *sql.DB, t reactionTarget, ids []int) ([]int, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.Query(t.published+"("+placeholders(len(ids))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var published []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		published = append(published, id)
+	}
+	return published, rows.Err()
+}
+
+// reactionSummaries summarizes the reactions to the given items with one
+// grouped query for the counts and one for the user's own reactions. Items
+// that are not published get an empty summary, like ones that do not exist.
+func reactionSummaries(db *sql.DB, t reactionTarget, user string, ids []int) (map[int]ReactionSummary, error) {
+	published, err := publishedIDs(db, t, ids)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := reactionCounts(db, t, published)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := viewerReactions(db, t, user, published)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make(map[int]ReactionSummary, len(ids))
+	for _, id := range ids {
+		summary := ReactionSummary{
+			Counts:          countsOrEmpty(counts[id]),
+			UserReactionGet: UserReactionGet{Reaction: legacyState(reactions[id]), Reactions: reactions[id]},
+		}
+		if summary.Reactions == nil {
+			summary.Reactions = []string{}
+		}
+		summaries[id] = summary
+	}
+	return summaries, nil
+}
+
+// ReactionBatchHandler returns the reactions to many threads and comments at
+// once, so lists do not need a request per item
+func ReactionBatchHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for ReactionBatch")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		var body ReactionBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if len(body.ThreadIDs) > maxReactionBatch || len(body.CommentIDs) > maxReactionBatch {
+			http.Error(w, "Too many IDs", http.StatusBadRequest)
+			log.Println("Too many IDs")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+
+		var response ReactionBatchGet
+		var err error
+		response.Threads, err = reactionSummaries(db, threadReactions, user, body.ThreadIDs)
+		if err == nil {
+			response.Comments, err = reactionSummaries(db, commentReactions, user, body.CommentIDs)
+		}
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched reactions for %d threads and %d comments", len(body.ThreadIDs), len(body.CommentIDs))
+	}
+}
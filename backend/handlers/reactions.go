@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Like and dislike are the reactions the original reaction routes know, as
+// states "1" and "0". A user can give only one of them to an item.
+const (
+	reactionLike    = "like"
+	reactionDislike = "dislike"
+)
+
+var reactionNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+type ReactionTypeGet struct {
+	Name     string `json:"name"`
+	Emoji    string `json:"emoji"`
+	Position int    `json:"position"`
+}
+
+type ReactionTypeSet struct {
+	Emoji    string `json:"emoji"`
+	Position int    `json:"position"`
+	Enabled  bool   `json:"enabled"`
+}
+
+// UserReactionGet is what the logged in user reacted with. Reaction is the
+// like/dislike state of the original routes: "1", "0" or "none".
+type UserReactionGet struct {
+	Reaction  string   `json:"reaction"`
+	Reactions []string `json:"reactions"`
+}
+
+// reactionTarget is what reactions can be given to
+type reactionTarget struct {
+	table  string
+	column string
+	// available reports whether an item exists and can be reacted to
+	available func(db *sql.DB, id int) (bool, error)
+	// notify tells the author of an item about a new reaction
+	notify func(db *sql.DB, id int, actor string, reaction string)
+	// published selects the IDs of items that are public, the list of IDs
+	// to pick from is appended
+	published string
+}
+
+var threadReactions = reactionTarget{
+	table:     "THREAD_REACTIONS",
+	column:    "thread_id",
+	available: threadIsPublished,
+	notify:    notifyThreadReaction,
+	published: "SELECT id FROM THREADS WHERE published = TRUE AND id IN ",
+}
+
+var commentReactions = reactionTarget{
+	table:  "COMMENT_REACTIONS",
+	column: "comment_id",
+	available: func(db *sql.DB, id int) (bool, error) {
+		// Deleted comments cannot be reacted to
+		var deleted bool
+		err := db.QueryRow("SELECT deleted_at IS NOT NULL FROM COMMENTS WHERE id = ?", id).Scan(&deleted)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return !deleted, err
+	},
+	notify:    notifyCommentReaction,
+	published: "SELECT c.id FROM COMMENTS c JOIN THREADS t ON t.id = c.thread_id WHERE t.published = TRUE AND c.id IN ",
+}
+
+// legacyReaction maps a state of the original reaction routes to a reaction
+func legacyReaction(state string) (string, bool) {
+	switch state {
+	case "1":
+		return reactionLike, true
+	case "0":
+		return reactionDislike, true
+	}
+	return "", false
+}
+
+// legacyState is the state of the original reaction routes for a user's reactions
+func legacyState(reactions []string) string {
+	for _, reaction := range reactions {
+		switch reaction {
+		case reactionLike:
+			return "1"
+		case reactionDislike:
+			return "0"
+		}
+	}
+	return "none"
+}
+
+// reactionEnabled reports whether a reaction type exists and can be given
+func reactionEnabled(db *sql.DB, name string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled FROM REACTION_TYPES WHERE name = ?", name).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return enabled, err
+}
+
+// addReaction adds a reaction of a user to an item and reports whether it is
+// new. Liking removes a dislike and the other way round.
+func addReaction(db *sql.DB, t reactionTarget, id int, userID int, reaction string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	opposite := map[string]string{reactionLike: reactionDislike, reactionDislike: reactionLike}[reaction]
+	if opposite != "" {
+		query := "DELETE FROM " + t.table + " WHERE user_id = ? AND " + t.column + " = ? AND reaction = ?"
+		if _, err := tx.Exec(query, userID, id, opposite); err != nil {
+			return false, err
+		}
+	}
+
+	query := "INSERT IGNORE INTO " + t.table + " (user_id, " + t.column + ", reaction) VALUES (?, ?, ?)"
+	result, err := tx.Exec(query, userID, id, reaction)
+	if err != nil {
+		return false, err
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, tx.Commit()
+}
+
+// removeReactions removes the given reactions of a user from an item
+func removeReactions(db *sql.DB, t reactionTarget, id int, userID int, reactions ...string) error {
+	args := []any{userID, id}
+	for _, reaction := range reactions {
+		args = append(args, reaction)
+	}
+	query := "DELETE FROM " + t.table + " WHERE user_id = ? AND " + t.column + " = ? AND reaction IN (" + placeholders(len(reactions)) + ")"
+	_, err := db.Exec(query, args...)
+	return err
+}
+
+// reactionCounts counts the reactions of enabled types given to each item,
+// keyed by item ID and reaction type. Items without reactions are left out.
+func reactionCounts(db *sql.DB, t reactionTarget, ids []int) (map[int]map[string]int, error) {
+	counts := make(map[int]map[string]int)
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	query := `
+    SELECT r.` + t.column + `, r.reaction, COUNT(*)
+    FROM ` + t.table + ` r
+    JOIN REACTION_TYPES rt ON rt.name = r.reaction AND rt.enabled = TRUE
+    WHERE r.` + t.column + ` IN (` + placeholders(len(ids)) + `)
+    GROUP BY r.` + t.column + `, r.reaction`
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		var reaction string
+		if err := rows.Scan(&id, &reaction, &count); err != nil {
+			return nil, err
+		}
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][reaction] = count
+	}
+	return counts, rows.Err()
+}
+
+// countsOrEmpty returns the counts of an item, or an empty map for items
+// without reactions so they encode as {} rather than null
+func countsOrEmpty(counts map[string]int) map[string]int {
+	if counts == nil {
+		return map[string]int{}
+	}
+	return counts
+}
+
+// viewerReactions returns the reactions of enabled types a user gave to each
+// item, in the order of the reaction types
+func viewerReactions(db *sql.DB, t reactionTarget, user string, ids []int) (map[int][]string, error) {
+	reactions := make(map[int][]string)
+	if user == "" || len(ids) == 0 {
+		return reactions, nil
+	}
+
+	query := `
+    SELECT r.` + t.column + `, r.reaction
+    FROM ` + t.table + ` r
+    JOIN USERS u ON u.id = r.user_id
+    JOIN REACTION_TYPES rt ON rt.name = r.reaction AND rt.enabled = TRUE
+    WHERE u.username = ? AND r.` + t.column + ` IN (` + placeholders(len(ids)) + `)
+    ORDER BY rt.position, rt.name`
+	args := []any{user}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var reaction string
+		if err := rows.Scan(&id, &reaction); err != nil {
+			return nil, err
+		}
+		reactions[id] = append(reactions[id], reaction)
+	}
+	return reactions, rows.Err()
+}
+
+// GetReactionTypesHandler lists the reactions users can give, in display order
+func GetReactionTypesHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetReactionTypes")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		rows, err := db.Query("SELECT name, emoji, position FROM REACTION_TYPES WHERE enabled = TRUE ORDER BY position, name")
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		types := []ReactionTypeGet{}
+		for rows.Next() {
+			var reactionType ReactionTypeGet
+			if err := rows.Scan(&reactionType.Name, &reactionType.Emoji, &reactionType.Position); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			types = append(types, reactionType)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(types); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Println("Successfully fetched reaction types")
+	}
+}
+
+// SetReactionTypeHandler adds or changes a reaction type. Disabled types can no
+// longer be given and are left out of counts, but reactions already given are
+// kept in case the type is enabled again. Moderators only.
+func SetReactionTypeHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for SetReactionType")
+
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		name := mux.Vars(r)["name"]
+		if !reactionNamePattern.MatchString(name) {
+			http.Error(w, "Reaction names must be 1 to 32 lower case letters, digits or underscores", http.StatusBadRequest)
+			return
+		}
+
+		var body ReactionTypeSet
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if body.Emoji == "" || len(body.Emoji) > 32 {
+			http.Error(w, "Emoji is required", http.StatusBadRequest)
+			return
+		}
+
+		query := `
+    INSERT INTO REACTION_TYPES (name, emoji, position, enabled) VALUES (?, ?, ?, ?)
+    ON DUPLICATE KEY UPDATE emoji = VALUES(emoji), position = VALUES(position), enabled = VALUES(enabled)`
+		if _, err := db.Exec(query, name, body.Emoji, body.Position, body.Enabled); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Reaction type %s set by %s", name, r.Context().Value("user").(string))
+	}
+}
+
+// reactionHandler adds or removes one reaction of the logged in user to a
+// thread or comment, depending on the request method
+func reactionHandler(db *sql.DB, t reactionTarget) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("Received request for Reaction on %s", t.table)
+
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		vars := mux.Vars(r)
+		id, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			log.Println("Invalid ID:", err)
+			return
+		}
+		reaction := vars["reaction"]
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var userID int
+		if err := db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&userID); err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := removeReactions(db, t, id, userID, reaction); err != nil {
+				http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+				log.Println("Error deleting data from database:", err)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"message":"Data successfully deleted"}`))
+			log.Printf("Removed reaction %s from %s %d by user %s", reaction, t.column, id, user)
+			return
+		}
+
+		enabled, err := reactionEnabled(db, reaction)
+		if err != nil {
+			http.Error(w, "Failed to get reaction type", http.StatusInternalServerError)
+			log.Println("Error getting reaction type:", err)
+			return
+		}
+		if !enabled {
+			http.Error(w, "Unknown reaction", http.StatusBadRequest)
+			return
+		}
+
+		available, err := t.available(db, id)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		if !available {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+
+		added, err := addReaction(db, t, id, userID, reaction)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		// Dislikes are not worth a notification
+		if added && reaction != reactionDislike {
+			t.notify(db, id, user, reaction)
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Added reaction %s to %s %d by user %s", reaction, t.column, id, user)
+	}
+}
+
+// ThreadReactionHandler adds (POST) or removes (DELETE) one reaction to a thread
+func ThreadReactionHandler(db *sql.DB) http.HandlerFunc {
+	return reactionHandler(db, threadReactions)
+}
+
+// CommentReactionHandler adds (POST) or removes (DELETE) one reaction to a comment
+func CommentReactionHandler(db *sql.DB) http.HandlerFunc {
+	return reactionHandler(db, commentReactions)
+}
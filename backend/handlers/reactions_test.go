@@ -0,0 +1,52 @@
+package handlers
+
+import "testing"
+
+func TestLegacyReaction(t *testing.T) {
+	tests := []struct {
+		state    string
+		reaction string
+		ok       bool
+	}{
+		{"1", reactionLike, true},
+		{"0", reactionDislike, true},
+		{"", "", false},
+		{"none", "", false},
+		{"like", "", false},
+		{"2", "", false},
+	}
+	for _, tt := range tests {
+		reaction, ok := legacyReaction(tt.state)
+		if reaction != tt.reaction || ok != tt.ok {
+			t.Errorf("legacyReaction(%q) = %q, %t, want %q, %t", tt.state, reaction, ok, tt.reaction, tt.ok)
+		}
+	}
+}
+
+func TestLegacyState(t *testing.T) {
+	tests := []struct {
+		reactions []string
+		want      string
+	}{
+		{nil, "none"},
+		{[]string{}, "none"},
+		{[]string{"like"}, "1"},
+		{[]string{"dislike"}, "0"},
+		{[]string{"heart", "eyes"}, "none"},
+		{[]string{"heart", "like", "party"}, "1"},
+		{[]string{"laugh", "dislike"}, "0"},
+	}
+	for _, tt := range tests {
+		if got := legacyState(tt.reactions); got != tt.want {
+			t.Errorf("legacyState(%q) = %q, want %q", tt.reactions, got, tt.want)
+		}
+	}
+
+	// Every state maps back to the reaction it came from
+	for _, state := range []string{"1", "0"} {
+		reaction, _ := legacyReaction(state)
+		if got := legacyState([]string{reaction}); got != state {
+			t.Errorf("legacyState(legacyReaction(%q)) = %q", state, got)
+		}
+	}
+}
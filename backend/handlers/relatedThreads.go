@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"web-forum/similarity"
+
+	"github.com/gorilla/mux"
+)
+
+type RelatedThreadGet struct {
+	ID       int     `json:"id"`
+	Title    string  `json:"title"`
+	Author   string  `json:"author"`
+	Category string  `json:"category"`
+	Time     string  `json:"time"`
+	Score    float64 `json:"score"`
+}
+
+// threadIndex caches the similarity index of all published threads. It is
+// rebuilt on the next lookup after threads change, and at least every
+// threadIndexTTL to pick up changes made by other backend instances.
+var threadIndex struct {
+	sync.Mutex
+	index   *similarity.Index
+	threads map[int]RelatedThreadGet
+	builtAt time.Time
+	// version counts invalidations, so an index built while threads
+	// changed is stale as soon as it is swapped in
+	version      int
+	builtVersion int
+}
+
+const threadIndexTTL = 10 * time.Minute
+
+// Threads scoring at least this against a new thread are likely duplicates
+const duplicateThreshold = 0.6
+
+type SimilarThreadsCheck struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+}
+
+// invalidateThreadIndex makes the next lookup rebuild the thread index
+func invalidateThreadIndex() {
+	threadIndex.Lock()
+	threadIndex.version++
+	threadIndex.Unlock()
+}
+
+// getThreadIndex returns the cached thread index, rebuilding it if needed.
+// The index is built without holding the lock so lookups are not held up by
+// the query.
+func getThreadIndex(db *sql.DB) (*similarity.Index, map[int]RelatedThreadGet, error) {
+	threadIndex.Lock()
+	if threadIndex.index != nil && threadIndex.builtVersion == threadIndex.version && time.Since(threadIndex.builtAt) < threadIndexTTL {
+		index, threads := threadIndex.index, threadIndex.threads
+		threadIndex.Unlock()
+		return index, threads, nil
+	}
+	version := threadIndex.version
+	threadIndex.Unlock()
+
+	index, threads, err := buildThreadIndex(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	threadIndex.Lock()
+	threadIndex.index = index
+	threadIndex.threads = threads
+	threadIndex.builtAt = time.Now()
+	threadIndex.builtVersion = version
+	threadIndex.Unlock()
+	return index, threads, nil
+}
+
+// buildThreadIndex indexes all published threads
+func buildThreadIndex(db *sql.DB) (*similarity.Index, map[int]RelatedThreadGet, error) {
+	query := `
+    SELECT t.id, t.title, t.description, t.author, c.category, t.created_at
+    FROM THREADS t
+    LEFT JOIN CATEGORIES c ON c.id = t.category_id
+    WHERE t.published = TRUE`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var docs []similarity.Document
+	threads := make(map[int]RelatedThreadGet)
+	for rows.Next() {
+		var doc similarity.Document
+		var thread RelatedThreadGet
+		var category sql.NullString
+		var threadTime time.Time
+		if err := rows.Scan(&doc.ID, &doc.Title, &doc.Body, &thread.Author, &category, &threadTime); err != nil {
+			return nil, nil, err
+		}
+		doc.Category = category.String
+		docs = append(docs, doc)
+
+		thread.ID = doc.ID
+		thread.Title = doc.Title
+		thread.Category = category.String
+		thread.Time = threadTime.Format(time.RFC3339)
+		threads[doc.ID] = thread
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("Built thread similarity index with %d threads", len(docs))
+	return similarity.NewIndex(docs), threads, nil
+}
+
+// findSimilarThreads returns existing threads that closely match a new thread
+func findSimilarThreads(db *sql.DB, title, description, category string) ([]RelatedThreadGet, error) {
+	index, threads, err := getThreadIndex(db)
+	if err != nil {
+		return nil, err
+	}
+
+	similar := []RelatedThreadGet{}
+	for _, match := range index.Similar(title, description, category, 5, duplicateThreshold) {
+		thread := threads[match.ID]
+		thread.Score = match.Score
+		similar = append(similar, thread)
+	}
+	return similar, nil
+}
+
+// SimilarThreadsHandler lets clients check for likely duplicates before
+// creating a thread
+func SimilarThreadsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for SimilarThreads")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		var body SimilarThreadsCheck
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		if body.Title == "" && body.Description == "" {
+			http.Error(w, "Title or Description is required", http.StatusBadRequest)
+			log.Println("Title and Description are missing")
+			return
+		}
+
+		similar, err := findSimilarThreads(db, body.Title, body.Description, body.Category)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error finding similar threads:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(similar); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Found %d similar threads", len(similar))
+	}
+}
+
+// GetRelatedThreadsHandler returns the threads most similar to a thread by
+// title and description, preferring threads in the same category
+func GetRelatedThreadsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetRelatedThreads")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		limit := 5
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			parsed, err := strconv.Atoi(limitStr)
+			if err != nil || parsed < 1 || parsed > 20 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = parsed
+		}
+
+		index, threads, err := getThreadIndex(db)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error building thread index:", err)
+			return
+		}
+
+		if _, ok := threads[threadID]; !ok {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			return
+		}
+
+		related := []RelatedThreadGet{}
+		for _, match := range index.Related(threadID, limit) {
+			thread := threads[match.ID]
+			thread.Score = match.Score
+			related = append(related, thread)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(related); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched related threads for thread with ID %d", threadID)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"testing"
+	"web-forum/similarity"
+)
+
+func TestDuplicateThreshold(t *testing.T) {
+	index := similarity.NewIndex([]similarity.Document{
+		{ID: 1, Title: "Docker container cannot connect to MySQL", Body: "My backend in a Docker container gets connection refused when connecting to MySQL on the host.", Category: "Help"},
+		{ID: 2, Title: "How do I reset my password?", Body: "I forgot my password and the reset email never arrives.", Category: "Help"},
+		{ID: 3, Title: "Show off your desk setup", Body: "Post a photo of where you work.", Category: "Off topic"},
+		{ID: 4, Title: "MySQL slow queries on large tables", Body: "Queries on a table with millions of rows take seconds, which indexes help?", Category: "Help"},
+		{ID: 5, Title: "Favourite Docker tips", Body: "Share the Docker tricks that save you time.", Category: "Guides"},
+	})
+
+	tests := []struct {
+		name      string
+		title     string
+		body      string
+		category  string
+		duplicate int
+	}{
+		{"reworded repost", "Cannot connect to MySQL from Docker container", "Connection refused when my Docker container connects to MySQL running on the host.", "Help", 1},
+		{"same question, short body", "Password reset email never arrives", "Forgot my password, no reset email.", "Help", 2},
+		{"shares a topic only", "Docker compose volumes explained", "How do volumes work in compose files?", "Guides", 0},
+		{"shares a word only", "MySQL backup strategy", "What do you use for nightly backups?", "Help", 0},
+		{"unrelated", "Recommend a mechanical keyboard", "Looking for a quiet one.", "Off topic", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := index.Similar(tt.title, tt.body, tt.category, 5, duplicateThreshold)
+			if tt.duplicate == 0 {
+				if len(matches) != 0 {
+					t.Errorf("flagged as duplicate of %v", matches)
+				}
+				return
+			}
+			if len(matches) == 0 || matches[0].ID != tt.duplicate {
+				all := index.Similar(tt.title, tt.body, tt.category, 5, 0)
+				t.Errorf("matches = %v, want %d first (all scores %v)", matches, tt.duplicate, all)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheRecorder buffers a response so its ETag can be computed before sending
+type cacheRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *cacheRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *cacheRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+// etagMatches compares an If-None-Match header with an ETag, ignoring weakness
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified reports whether the client's cached copy is still current
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	return header != "" && etagMatches(header, etag)
+}
+
+// CacheMiddleware adds an ETag header to the responses of a GET handler and
+// answers conditional requests for unchanged content with 304 Not Modified.
+// The ETag is a hash of the response body. There is no Last-Modified header,
+// most content has no reliable modification time of its own.
+// Responses for logged in users include their own bookmarks and reactions, so
+// they are marked private. maxAge is how long clients may use a response
+// without revalidating it. Must be wrapped in JWTMiddleware or
+// OptionalJWTMiddleware if the handler depends on the user.
+func CacheMiddleware(next http.Handler, maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &cacheRecorder{header: make(http.Header)}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		for name, values := range rec.header {
+			w.Header()[name] = values
+		}
+
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		sum := sha256.Sum256(rec.body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+		user, _ := r.Context().Value("user").(string)
+		visibility := "public"
+		if user != "" {
+			visibility = "private"
+		}
+		cacheControl := visibility + ", no-cache"
+		if maxAge > 0 {
+			cacheControl = visibility + ", max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Add("Vary", "Authorization")
+
+		if notModified(r, etag) {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write(rec.body.Bytes())
+	})
+}
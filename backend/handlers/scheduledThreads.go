@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+type ScheduledThreadGet struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Category    string `json:"category"`
+	PublishAt   string `json:"publish_at"`
+}
+
+// threadPublished runs the side effects of a thread becoming visible, both for
+// threads created directly and for scheduled threads reaching their publish time
+func threadPublished(db *sql.DB, threadID int64, author string) {
+	log.Printf("Thread %d by %s published", threadID, author)
+
+	if err := subscribeToThread(db, threadID, author); err != nil {
+		log.Println("Error subscribing author to thread:", err)
+	}
+
+	threadMentionsChanged(db, threadID)
+	invalidateThreadIndex()
+}
+
+// threadIsPublished reports whether a thread exists and is visible to everyone
+func threadIsPublished(db *sql.DB, threadID int) (bool, error) {
+	var published bool
+	err := db.QueryRow("SELECT published FROM THREADS WHERE id = ?", threadID).Scan(&published)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return published, err
+}
+
+// publishDueThreads publishes every scheduled thread whose publish time has
+// passed and returns how many were published
+func publishDueThreads(db *sql.DB) (int, error) {
+	rows, err := db.Query("SELECT id, author FROM THREADS WHERE published = FALSE AND publish_at <= ?", time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	type dueThread struct {
+		id     int64
+		author string
+	}
+	var due []dueThread
+	for rows.Next() {
+		var thread dueThread
+		if err := rows.Scan(&thread.id, &thread.author); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, thread)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, thread := range due {
+		// The published = FALSE guard makes sure only one scheduler publishes a
+		// thread when several instances of the backend are running
+		query := "UPDATE THREADS SET published = TRUE, created_at = publish_at WHERE id = ? AND published = FALSE"
+		result, err := db.Exec(query, thread.id)
+		if err != nil {
+			log.Printf("Error publishing thread %d: %v", thread.id, err)
+			continue
+		}
+		if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+			continue
+		}
+
+		threadPublished(db, thread.id, thread.author)
+		published++
+	}
+
+	return published, nil
+}
+
+// nextPublishTime returns the earliest publish time of a pending thread
+func nextPublishTime(db *sql.DB) (time.Time, bool, error) {
+	var next sql.NullTime
+	err := db.QueryRow("SELECT MIN(publish_at) FROM THREADS WHERE published = FALSE").Scan(&next)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return next.Time, next.Valid, nil
+}
+
+// StartThreadScheduler publishes scheduled threads in the background. It checks
+// at least once per interval and wakes up early for the next pending thread.
+func StartThreadScheduler(db *sql.DB, interval time.Duration) {
+	go func() {
+		for {
+			count, err := publishDueThreads(db)
+			if err != nil {
+				log.Println("Error publishing scheduled threads:", err)
+			} else if count > 0 {
+				log.Printf("Published %d scheduled threads", count)
+			}
+
+			wait := interval
+			next, ok, err := nextPublishTime(db)
+			if err != nil {
+				log.Println("Error getting next publish time:", err)
+			} else if ok {
+				if untilNext := time.Until(next); untilNext < wait {
+					wait = max(untilNext, time.Second)
+				}
+			}
+
+			time.Sleep(wait)
+		}
+	}()
+}
+
+// GetScheduledThreadsHandler retrieves the logged in user's threads that are
+// waiting to be published
+func GetScheduledThreadsHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetScheduledThreads")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := `
+    SELECT t.id, t.title, t.description, c.category, t.publish_at
+    FROM THREADS t
+    LEFT JOIN CATEGORIES c ON c.id = t.category_id
+    WHERE t.author = ? AND t.published = FALSE
+    ORDER BY t.publish_at`
+		rows, err := db.Query(query, user)
+		if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+		defer rows.Close()
+
+		var threads []ScheduledThreadGet
+		for rows.Next() {
+			var thread ScheduledThreadGet
+			var category sql.NullString
+			var publishAt time.Time
+			if err := rows.Scan(&thread.ID, &thread.Title, &thread.Description, &category, &publishAt); err != nil {
+				http.Error(w, "Failed to parse database rows", http.StatusInternalServerError)
+				log.Println("Error parsing database row:", err)
+				return
+			}
+			thread.Category = category.String
+			thread.PublishAt = publishAt.Format(time.RFC3339)
+			threads = append(threads, thread)
+		}
+
+		if err := rows.Err(); err != nil {
+			http.Error(w, "Error iterating database rows", http.StatusInternalServerError)
+			log.Println("Error iterating database rows:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(threads); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched scheduled threads for user %s", user)
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"web-forum/utils"
+
+	"github.com/gorilla/mux"
+)
+
+// ThreadBySlugGet is a thread looked up by slug. RedirectTo is set to the
+// current slug when the thread was found by an old slug, so clients can update
+// the URL they show.
+type ThreadBySlugGet struct {
+	ThreadGet
+	RedirectTo string `json:"redirect_to,omitempty"`
+}
+
+// queryExecer is implemented by both *sql.DB and *sql.Tx
+type queryExecer interface {
+	execer
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// assignThreadSlug makes the slug of a thread's title its current slug. Old
+// slugs stay in THREAD_SLUGS so links using them keep working. If another
+// thread already uses the slug, the thread ID is appended to keep it unique.
+func assignThreadSlug(db queryExecer, threadID int64, title string) (string, error) {
+	base := utils.Slugify(title)
+	if base == "" {
+		base = "thread"
+	}
+
+	slug := base
+	for attempt := 1; ; attempt++ {
+		// Inserting first means two threads racing for a slug cannot both
+		// see it as free
+		result, err := db.Exec("INSERT IGNORE INTO THREAD_SLUGS (slug, thread_id) VALUES (?, ?)", slug, threadID)
+		if err != nil {
+			return "", err
+		}
+		if inserted, err := result.RowsAffected(); err != nil {
+			return "", err
+		} else if inserted == 1 {
+			break
+		}
+
+		var owner int64
+		if err := db.QueryRow("SELECT thread_id FROM THREAD_SLUGS WHERE slug = ?", slug).Scan(&owner); err != nil {
+			return "", err
+		}
+		// The thread is going back to one of its old slugs
+		if owner == threadID {
+			break
+		}
+
+		if attempt == 1 {
+			slug = fmt.Sprintf("%s-%d", base, threadID)
+		} else {
+			slug = fmt.Sprintf("%s-%d-%d", base, threadID, attempt)
+		}
+	}
+
+	if _, err := db.Exec("UPDATE THREADS SET slug = ? WHERE id = ?", slug, threadID); err != nil {
+		return "", err
+	}
+	return slug, nil
+}
+
+// BackfillThreadSlugs gives threads created before slugs existed a slug
+func BackfillThreadSlugs(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, title FROM THREADS WHERE slug IS NULL")
+	if err != nil {
+		return err
+	}
+
+	type thread struct {
+		id    int64
+		title string
+	}
+	var threads []thread
+	for rows.Next() {
+		var t thread
+		if err := rows.Scan(&t.id, &t.title); err != nil {
+			rows.Close()
+			return err
+		}
+		threads = append(threads, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range threads {
+		if _, err := assignThreadSlug(db, t.id, t.title); err != nil {
+			return err
+		}
+	}
+
+	if len(threads) > 0 {
+		log.Printf("Assigned slugs to %d threads", len(threads))
+	}
+	return nil
+}
+
+// GetThreadBySlugHandler retrieves a Thread by its current or any earlier slug
+// and counts the request as a view of the thread
+func GetThreadBySlugHandler(db *sql.DB, views *ViewCounter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetThreadBySlug")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		slug := mux.Vars(r)["slug"]
+		log.Printf("Thread slug: %s", slug)
+
+		var threadID int
+		query := "SELECT s.thread_id FROM THREAD_SLUGS s JOIN THREADS t ON t.id = s.thread_id WHERE s.slug = ? AND t.published = TRUE"
+		if err := db.QueryRow(query, slug).Scan(&threadID); err == sql.ErrNoRows {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			log.Println("Thread not found:", slug)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		thread, err := loadThread(db, views, r, threadID)
+		if err != nil {
+			http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+			log.Println("Error getting thread:", err)
+			return
+		}
+
+		response := ThreadBySlugGet{ThreadGet: thread}
+		if thread.Slug != slug {
+			response.RedirectTo = thread.Slug
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched thread with slug %s", slug)
+	}
+}
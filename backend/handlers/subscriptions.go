@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type FollowGet struct {
+	Following bool `json:"following"`
+}
+
+// subscribeToThread subscribes a user to a thread unless they are subscribed
+// already or have unfollowed it before
+func subscribeToThread(db *sql.DB, threadID int64, username string) error {
+	query := "INSERT IGNORE INTO THREAD_SUBSCRIPTIONS (user_id, thread_id) SELECT id, ? FROM USERS WHERE username = ?"
+	_, err := db.Exec(query, threadID, username)
+	return err
+}
+
+// commentCreated subscribes the commenter to the thread, notifies the users
+// mentioned in the comment and notifies all other subscribers about the reply
+func commentCreated(db *sql.DB, threadID int64, commentID int64, author string, content string) {
+	if err := subscribeToThread(db, threadID, author); err != nil {
+		log.Println("Error subscribing commenter to thread:", err)
+	}
+
+	if err := syncMentions(db, "comment_id", commentID, threadID, author, content); err != nil {
+		log.Println("Error recording comment mentions:", err)
+	}
+
+	details, err := json.Marshal(NotificationDetails{Excerpt: excerpt(content)})
+	if err != nil {
+		log.Println("Error encoding notification details:", err)
+		return
+	}
+
+	// One statement for all subscribers instead of emitNotification per user
+	query := `
+    INSERT INTO NOTIFICATIONS (user_id, type, actor, thread_id, comment_id, details)
+    SELECT s.user_id, ?, ?, s.thread_id, ?, ?
+    FROM THREAD_SUBSCRIPTIONS s
+    JOIN USERS u ON u.id = s.user_id
+    WHERE s.thread_id = ? AND s.subscribed = TRUE AND u.username <> ?`
+	if _, err := db.Exec(query, NotificationReply, author, commentID, string(details), threadID, author); err != nil {
+		log.Println("Error creating reply notifications:", err)
+	}
+}
+
+// GetFollowHandler returns whether the logged in user follows a thread
+func GetFollowHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for GetFollow")
+
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var follow FollowGet
+		query := `
+    SELECT s.subscribed
+    FROM THREAD_SUBSCRIPTIONS s
+    JOIN USERS u ON u.id = s.user_id
+    WHERE s.thread_id = ? AND u.username = ?`
+		err = db.QueryRow(query, threadID, user).Scan(&follow.Following)
+		if err != nil && err != sql.ErrNoRows {
+			http.Error(w, "Failed to query database", http.StatusInternalServerError)
+			log.Println("Error querying database:", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(follow); err != nil {
+			http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+			log.Println("Error encoding JSON:", err)
+		}
+
+		log.Printf("Successfully fetched follow state of thread %d for user %s", threadID, user)
+	}
+}
+
+// setFollowHandler follows or unfollows a thread for the logged in user
+func setFollowHandler(db *sql.DB, method string, subscribed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for SetFollow")
+
+		if r.Method != method {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		threadID, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid Thread ID", http.StatusBadRequest)
+			log.Println("Invalid Thread ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+		if user == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var user_id int
+		err = db.QueryRow("SELECT id FROM USERS WHERE username = ?", user).Scan(&user_id)
+		if err != nil {
+			http.Error(w, "Failed to get user ID", http.StatusInternalServerError)
+			log.Println("Error getting user ID:", err)
+			return
+		}
+
+		published, err := threadIsPublished(db, threadID)
+		if err != nil {
+			http.Error(w, "Failed to get thread", http.StatusInternalServerError)
+			log.Println("Error getting thread from database:", err)
+			return
+		}
+		if !published {
+			http.Error(w, "Thread not found", http.StatusNotFound)
+			log.Println("Thread not found:", threadID)
+			return
+		}
+
+		query := "INSERT INTO THREAD_SUBSCRIPTIONS (user_id, thread_id, subscribed) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE subscribed = VALUES(subscribed)"
+		_, err = db.Exec(query, user_id, threadID, subscribed)
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error inserting data into database:", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully submitted"}`))
+		log.Printf("Successfully set follow state of thread %d for user %s to %t", threadID, user, subscribed)
+	}
+}
+
+// FollowThreadHandler subscribes the logged in user to replies in a thread
+func FollowThreadHandler(db *sql.DB) http.HandlerFunc {
+	return setFollowHandler(db, http.MethodPost, true)
+}
+
+// UnfollowThreadHandler stops reply notifications for a thread, also after the
+// user comments on it again
+func UnfollowThreadHandler(db *sql.DB) http.HandlerFunc {
+	return setFollowHandler(db, http.MethodDelete, false)
+}
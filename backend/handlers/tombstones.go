@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"web-forum/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// Who deleted a comment, as stored in COMMENTS.deleted_by
+const (
+	deletedByAuthor    = "author"
+	deletedByModerator = "moderator"
+)
+
+// Deleted comments that are kept as tombstones show this as their author and content
+const deletedPlaceholder = "[deleted]"
+
+type CommentRemove struct {
+	Reason string `json:"reason"`
+}
+
+// commentReferenced reports whether a comment has replies or is quoted, in
+// which case deleting it would break the conversation around it
+func commentReferenced(tx *sql.Tx, commentID int64) (bool, error) {
+	var referenced bool
+	query := `
+    SELECT EXISTS(SELECT 1 FROM COMMENTS WHERE parent_id = ?)
+        OR EXISTS(SELECT 1 FROM COMMENT_QUOTES WHERE quoted_comment_id = ?)`
+	err := tx.QueryRow(query, commentID, commentID).Scan(&referenced)
+	return referenced, err
+}
+
+// commentAttachmentKeys returns the storage keys of a comment's attachments
+func commentAttachmentKeys(tx *sql.Tx, commentID int64) ([]string, error) {
+	rows, err := tx.Query("SELECT storage_key FROM ATTACHMENTS WHERE comment_id = ?", commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// threadAttachmentKeys returns the storage keys of the attachments of a
+// thread and its comments
+func threadAttachmentKeys(tx *sql.Tx, threadID int) ([]string, error) {
+	query := `
+    SELECT storage_key FROM ATTACHMENTS
+    WHERE thread_id = ? OR comment_id IN (SELECT id FROM COMMENTS WHERE thread_id = ?)`
+	rows, err := tx.Query(query, threadID, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteComment deletes a comment. Comments with replies or quotes become
+// tombstones: the row stays so the conversation keeps its shape, but the
+// author, content, attachments, history and reactions are removed, as is the
+// text quoted from it. Others are deleted, along with tombstones left without
+// replies or quotes. Returns the storage keys of the deleted attachments, for
+// the caller to remove from storage once the transaction is committed.
+func deleteComment(tx *sql.Tx, commentID int64, deletedBy string) ([]string, error) {
+	referenced, err := commentReferenced(tx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := commentAttachmentKeys(tx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if referenced {
+		return attachments, execAll(tx, []statement{
+			{`UPDATE COMMENTS SET author = ?, content = ?, content_html = NULL, edited_at = NULL, edit_count = 0,
+        deleted_at = CURRENT_TIMESTAMP, deleted_by = ? WHERE id = ?`, []any{deletedPlaceholder, deletedPlaceholder, deletedBy, commentID}},
+			{"DELETE FROM COMMENT_REACTIONS WHERE comment_id = ?", []any{commentID}},
+			{"DELETE FROM COMMENT_REVISIONS WHERE comment_id = ?", []any{commentID}},
+			{"DELETE FROM COMMENT_QUOTES WHERE comment_id = ?", []any{commentID}},
+			{"DELETE FROM MENTIONS WHERE comment_id = ?", []any{commentID}},
+			{"UPDATE COMMENT_QUOTES SET quoted_author = ?, quoted_text = ? WHERE quoted_comment_id = ?", []any{deletedPlaceholder, deletedPlaceholder, commentID}},
+			{"DELETE FROM ATTACHMENTS WHERE comment_id = ?", []any{commentID}},
+			// Notifications include an excerpt of the content
+			{"DELETE FROM NOTIFICATIONS WHERE comment_id = ?", []any{commentID}},
+			{"UPDATE THREADS SET accepted_comment_id = NULL WHERE accepted_comment_id = ?", []any{commentID}},
+		})
+	}
+
+	// Tombstones the comment was holding on to may not be needed any more
+	var candidates []int64
+	var parentID sql.NullInt64
+	if err := tx.QueryRow("SELECT parent_id FROM COMMENTS WHERE id = ?", commentID).Scan(&parentID); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		candidates = append(candidates, parentID.Int64)
+	}
+	rows, err := tx.Query("SELECT quoted_comment_id FROM COMMENT_QUOTES WHERE comment_id = ? AND quoted_comment_id IS NOT NULL", commentID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var quotedID int64
+		if err := rows.Scan(&quotedID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, quotedID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Its attachment rows are deleted along with it by their foreign key
+	if _, err := tx.Exec("DELETE FROM COMMENTS WHERE id = ?", commentID); err != nil {
+		return nil, err
+	}
+	return attachments, pruneTombstones(tx, candidates)
+}
+
+// pruneTombstones deletes the given tombstones once nothing refers to them,
+// and then their parents in turn
+func pruneTombstones(tx *sql.Tx, commentIDs []int64) error {
+	for len(commentIDs) > 0 {
+		commentID := commentIDs[0]
+		commentIDs = commentIDs[1:]
+
+		var deleted bool
+		var parentID sql.NullInt64
+		err := tx.QueryRow("SELECT deleted_at IS NOT NULL, parent_id FROM COMMENTS WHERE id = ?", commentID).Scan(&deleted, &parentID)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !deleted {
+			continue
+		}
+
+		referenced, err := commentReferenced(tx, commentID)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			continue
+		}
+
+		if _, err := tx.Exec("DELETE FROM COMMENTS WHERE id = ?", commentID); err != nil {
+			return err
+		}
+		if parentID.Valid {
+			commentIDs = append(commentIDs, parentID.Int64)
+		}
+	}
+	return nil
+}
+
+// RemoveCommentHandler lets a moderator delete a comment of another user. The
+// author is notified and the removal recorded in the moderation log.
+func RemoveCommentHandler(db *sql.DB, store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Println("Received request for RemoveComment")
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			log.Println("Method not allowed")
+			return
+		}
+
+		idStr := mux.Vars(r)["id"]
+		commentID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Comment ID", http.StatusBadRequest)
+			log.Println("Invalid Comment ID:", err)
+			return
+		}
+
+		user := r.Context().Value("user").(string)
+
+		var body CommentRemove
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			log.Println("Error decoding request body:", err)
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+			log.Println("Error starting transaction:", err)
+			return
+		}
+		defer tx.Rollback()
+
+		var threadID int64
+		var author string
+		query := "SELECT thread_id, author FROM COMMENTS WHERE id = ? AND deleted_at IS NULL FOR UPDATE"
+		err = tx.QueryRow(query, commentID).Scan(&threadID, &author)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to get comment", http.StatusInternalServerError)
+			log.Println("Error getting comment from database:", err)
+			return
+		}
+
+		attachments, err := deleteComment(tx, commentID, deletedByModerator)
+		if err != nil {
+			http.Error(w, "Failed to delete data", http.StatusInternalServerError)
+			log.Println("Error deleting comment:", err)
+			return
+		}
+
+		details := ModerationDetails{CommentIDs: []int64{commentID}}
+		if err := recordModeration(tx, user, "remove_comment", threadID, nil, details, body.Reason); err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error recording moderation:", err)
+			return
+		}
+
+		err = notifyModeration(tx, author, Notification{
+			Type:                NotificationModeration,
+			Actor:               user,
+			ThreadID:            &threadID,
+			NotificationDetails: NotificationDetails{Action: "remove_comment", Reason: body.Reason},
+		})
+		if err != nil {
+			http.Error(w, "Failed to insert data", http.StatusInternalServerError)
+			log.Println("Error creating moderation notification:", err)
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+			log.Println("Error committing transaction:", err)
+			return
+		}
+		deleteBlobs(r.Context(), store, attachments)
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"message":"Data successfully deleted"}`))
+		log.Printf("Comment %d removed by %s", commentID, user)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ViewCounter counts thread views in memory and writes them to THREADS in
+// batches, so reading a thread does not cost a database write. A viewer is
+// only counted once per thread within the de-duplication window.
+type ViewCounter struct {
+	db      *sql.DB
+	window  time.Duration
+	proxies []*net.IPNet
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	pending map[int]int
+}
+
+// NewViewCounter creates a view counter. Anonymous viewers are told apart by
+// IP, read from X-Forwarded-For only for requests from the trusted proxies.
+func NewViewCounter(db *sql.DB, window time.Duration, trustedProxies []*net.IPNet) *ViewCounter {
+	return &ViewCounter{
+		db:      db,
+		window:  window,
+		proxies: trustedProxies,
+		seen:    make(map[string]time.Time),
+		pending: make(map[int]int),
+	}
+}
+
+// ParseTrustedProxies parses a comma separated list of IP addresses and CIDR
+// ranges, such as the TRUSTED_PROXIES environment variable
+func ParseTrustedProxies(list string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", entry)
+			}
+			bits := 8 * len(ip)
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+// trusted reports whether an address is one of the trusted proxies
+func (c *ViewCounter) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.proxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client. X-Forwarded-For can be set by
+// anyone, so it is only read when the request comes from a trusted proxy, and
+// then from the right, since each proxy appends the address it saw. The first
+// address that is not a trusted proxy is the client.
+func (c *ViewCounter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !c.trusted(host) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !c.trusted(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// viewerKey identifies logged in users by username and everyone else by IP
+func (c *ViewCounter) viewerKey(r *http.Request) string {
+	if user, _ := r.Context().Value("user").(string); user != "" {
+		return "user:" + user
+	}
+	return "ip:" + c.clientIP(r)
+}
+
+// Record counts a view of the thread unless the viewer was already counted
+// within the window
+func (c *ViewCounter) Record(threadID int, r *http.Request) {
+	key := fmt.Sprintf("%d|%s", threadID, c.viewerKey(r))
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if last, ok := c.seen[key]; ok && now.Sub(last) < c.window {
+		return
+	}
+	c.seen[key] = now
+	c.pending[threadID]++
+}
+
+// Pending returns the views of a thread that have not been flushed yet
+func (c *ViewCounter) Pending(threadID int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending[threadID]
+}
+
+// Flush writes the buffered views to the database and forgets viewers whose
+// window has passed
+func (c *ViewCounter) Flush() error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[int]int)
+	now := time.Now()
+	for key, last := range c.seen {
+		if now.Sub(last) >= c.window {
+			delete(c.seen, key)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	tx, err := c.db.Begin()
+	if err == nil {
+		for threadID, views := range pending {
+			if _, err = tx.Exec("UPDATE THREADS SET view_count = view_count + ? WHERE id = ?", views, threadID); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			err = tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+
+	// Put the views back so they are retried with the next flush
+	if err != nil {
+		c.mu.Lock()
+		for threadID, views := range pending {
+			c.pending[threadID] += views
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Start flushes the buffered views in the background once per interval
+func (c *ViewCounter) Start(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			if err := c.Flush(); err != nil {
+				log.Println("Error flushing thread views:", err)
+			}
+		}
+	}()
+}
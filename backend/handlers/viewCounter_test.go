@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewViewCounter(nil, 0, proxies)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted client setting the header", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop before the real client", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", []string{"198.51.100.1, 192.168.1.1, 10.1.1.1"}, "198.51.100.1"},
+		{"several header lines", "10.0.0.2:5000", []string{"1.2.3.4", "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without the header", "10.0.0.2:5000", nil, "10.0.0.2"},
+		{"only trusted hops", "10.0.0.2:5000", []string{"10.0.0.3, 10.0.0.4"}, "10.0.0.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := c.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("")
+	if err != nil || len(proxies) != 0 {
+		t.Errorf("ParseTrustedProxies(\"\") = %v, %v", proxies, err)
+	}
+	if _, err := ParseTrustedProxies("10.0.0.0/8,not-an-ip"); err == nil {
+		t.Error("ParseTrustedProxies accepted an invalid address")
+	}
+	proxies, err = ParseTrustedProxies("::1, 172.16.0.0/12")
+	if err != nil || len(proxies) != 2 {
+		t.Errorf("ParseTrustedProxies = %v, %v", proxies, err)
+	}
+}
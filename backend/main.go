@@ -5,9 +5,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"web-forum/db"
+	"web-forum/handlers"
 	"web-forum/routes"
+	"web-forum/storage"
 )
 
 type User struct {
@@ -32,8 +35,30 @@ func main() {
 		log.Fatalf("Failed to create tables: %v", err)
 	}
 
+	// Set up attachment storage
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+
+	// Give threads from before slugs existed a slug
+	if err := handlers.BackfillThreadSlugs(database); err != nil {
+		log.Fatalf("Failed to assign thread slugs: %v", err)
+	}
+
+	// Publish scheduled threads in the background
+	handlers.StartThreadScheduler(database, 30*time.Second)
+
+	// Count thread views in memory and write them to the database in batches
+	proxies, err := handlers.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	views := handlers.NewViewCounter(database, 30*time.Minute, proxies)
+	views.Start(time.Minute)
+
 	// Set up routes
-	mux := routes.SetupRoutes(database)
+	mux := routes.SetupRoutes(database, store, views)
 
 	// Start the server
 	log.Printf("Server running on http://localhost%s", port)
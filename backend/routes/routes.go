@@ -2,12 +2,14 @@ package routes
 
 import (
 	"database/sql"
+	"time"
 	"web-forum/handlers"
+	"web-forum/storage"
 
 	"github.com/gorilla/mux"
 )
 
-func SetupRoutes(db *sql.DB) *mux.Router {
+func SetupRoutes(db *sql.DB, store storage.BlobStore, views *handlers.ViewCounter) *mux.Router {
 	// Create a new router
 	router := mux.NewRouter()
 
@@ -16,32 +18,82 @@ func SetupRoutes(db *sql.DB) *mux.Router {
 	router.HandleFunc("/api/login", handlers.LoginHandler(db)).Methods("POST")
 	router.Handle("/api/login/token", handlers.JWTMiddleware(handlers.LoginWithToken())).Methods("POST")
 
-	router.HandleFunc("/api/threads", handlers.GetAllThreadsHandler(db)).Methods("GET")
-	router.HandleFunc("/api/threads/search/{searchTerm}", handlers.GetSearchThreadsHandler(db)).Methods("GET")
+	router.Handle("/api/threads", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetAllThreadsHandler(db), 0))).Methods("GET")
+	router.Handle("/api/threads/search/{searchTerm}", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetSearchThreadsHandler(db), 0))).Methods("GET")
 	router.Handle("/api/threads", handlers.JWTMiddleware(handlers.CreateThreadHandler(db))).Methods("POST")
+	router.HandleFunc("/api/threads/similar", handlers.SimilarThreadsHandler(db)).Methods("POST")
+	router.Handle("/api/threads/by-slug/{slug}", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetThreadBySlugHandler(db, views), 0))).Methods("GET")
+	router.Handle("/api/threads/scheduled", handlers.JWTMiddleware(handlers.GetScheduledThreadsHandler(db))).Methods("GET")
 	router.Handle("/api/threads/{id}", handlers.JWTMiddleware(handlers.UpdateThreadHandler(db))).Methods("PUT")
-	router.HandleFunc("/api/threads/{id}", handlers.GetThreadByIDHandler(db)).Methods("GET")
-	router.Handle("/api/threads/{id}", handlers.JWTMiddleware(handlers.DeleteThreadHandler(db))).Methods("DELETE")
+	router.Handle("/api/threads/{id}", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetThreadByIDHandler(db, views), 0))).Methods("GET")
+	router.Handle("/api/threads/{id}", handlers.JWTMiddleware(handlers.DeleteThreadHandler(db, store))).Methods("DELETE")
 
-	router.HandleFunc("/api/threads/{id}/reactions", handlers.GetThreadReaction(db)).Methods("GET")
+	router.Handle("/api/threads/{id}/reactions", handlers.CacheMiddleware(handlers.GetThreadReaction(db), 0)).Methods("GET")
 	router.Handle("/api/threads/{id}/reactions/user", handlers.JWTMiddleware(handlers.GetThreadUserReaction(db))).Methods("GET")
 	router.Handle("/api/threads/{id}/reactions", handlers.JWTMiddleware(handlers.UpdateThreadReaction(db))).Methods("POST")
 	router.Handle("/api/threads/{id}/reactions", handlers.JWTMiddleware(handlers.DeleteThreadReaction(db))).Methods("DELETE")
+	router.Handle("/api/threads/{id}/reactions/{reaction}", handlers.JWTMiddleware(handlers.ThreadReactionHandler(db))).Methods("POST", "DELETE")
 
-	router.HandleFunc("/api/threads/{id}/comments", handlers.GetCommentsByThreadHandler(db)).Methods("GET")
+	router.Handle("/api/threads/{id}/related", handlers.CacheMiddleware(handlers.GetRelatedThreadsHandler(db), 0)).Methods("GET")
+
+	router.Handle("/api/threads/{id}/poll/votes", handlers.JWTMiddleware(handlers.VotePollHandler(db))).Methods("POST")
+	router.Handle("/api/threads/{id}/poll/votes", handlers.JWTMiddleware(handlers.UnvotePollHandler(db))).Methods("DELETE")
+
+	router.Handle("/api/threads/{id}/follow", handlers.JWTMiddleware(handlers.GetFollowHandler(db))).Methods("GET")
+	router.Handle("/api/threads/{id}/follow", handlers.JWTMiddleware(handlers.FollowThreadHandler(db))).Methods("POST")
+	router.Handle("/api/threads/{id}/follow", handlers.JWTMiddleware(handlers.UnfollowThreadHandler(db))).Methods("DELETE")
+
+	router.Handle("/api/threads/{id}/comments", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetCommentsByThreadHandler(db), 0))).Methods("GET")
 	router.Handle("/api/threads/{id}/comments", handlers.JWTMiddleware(handlers.CreateCommentHandler(db))).Methods("POST")
+	router.Handle("/api/comments/{id}/replies", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetCommentRepliesHandler(db), 0))).Methods("GET")
+	router.Handle("/api/comments/{id}", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetCommentHandler(db), 0))).Methods("GET")
 	router.Handle("/api/comments/{id}", handlers.JWTMiddleware(handlers.UpdateCommentHandler(db))).Methods("PUT")
-	router.Handle("/api/comments/{id}", handlers.JWTMiddleware(handlers.DeleteCommentHandler(db))).Methods("DELETE")
+	router.Handle("/api/comments/{id}", handlers.JWTMiddleware(handlers.DeleteCommentHandler(db, store))).Methods("DELETE")
+	router.Handle("/api/threads/{id}/answer", handlers.JWTMiddleware(handlers.AcceptAnswerHandler(db))).Methods("POST")
+	router.Handle("/api/threads/{id}/answer", handlers.JWTMiddleware(handlers.ClearAnswerHandler(db))).Methods("DELETE")
+	router.Handle("/api/comments/{id}/revisions", handlers.JWTMiddleware(handlers.GetCommentRevisionsHandler(db))).Methods("GET")
 
-	router.HandleFunc("/api/comments/{id}/reactions", handlers.GetCommentReaction(db)).Methods("GET")
+	router.Handle("/api/comments/{id}/reactions", handlers.CacheMiddleware(handlers.GetCommentReaction(db), 0)).Methods("GET")
 	router.Handle("/api/comments/{id}/reactions/user", handlers.JWTMiddleware(handlers.GetCommentUserReaction(db))).Methods("GET")
 	router.Handle("/api/comments/{id}/reactions", handlers.JWTMiddleware(handlers.UpdateCommentReaction(db))).Methods("POST")
 	router.Handle("/api/comments/{id}/reactions", handlers.JWTMiddleware(handlers.DeleteCommentReaction(db))).Methods("DELETE")
+	router.Handle("/api/comments/{id}/reactions/{reaction}", handlers.JWTMiddleware(handlers.CommentReactionHandler(db))).Methods("POST", "DELETE")
+
+	router.Handle("/api/user/{user}/comments", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetCommentsByUserHandler(db), 0))).Methods("GET")
+	router.Handle("/api/user/{user}/threads", handlers.OptionalJWTMiddleware(handlers.CacheMiddleware(handlers.GetThreadsByUserHandler(db), 0))).Methods("GET")
+
+	router.Handle("/api/user/me/bookmarks", handlers.JWTMiddleware(handlers.GetBookmarksHandler(db))).Methods("GET")
+	router.Handle("/api/threads/{id}/bookmark", handlers.JWTMiddleware(handlers.ThreadBookmarkHandler(db))).Methods("POST", "DELETE")
+	router.Handle("/api/comments/{id}/bookmark", handlers.JWTMiddleware(handlers.CommentBookmarkHandler(db))).Methods("POST", "DELETE")
+
+	router.Handle("/api/categories", handlers.CacheMiddleware(handlers.GetAllCategoriesHandler(db), 5*time.Minute)).Methods("GET")
+	router.Handle("/api/categories/{id}/qa-mode", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.SetCategoryQAModeHandler(db)))).Methods("PUT")
+
+	router.Handle("/api/reactions/types", handlers.CacheMiddleware(handlers.GetReactionTypesHandler(db), 5*time.Minute)).Methods("GET")
+	router.Handle("/api/reactions/types/{name}", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.SetReactionTypeHandler(db)))).Methods("PUT")
+	router.Handle("/api/reactions/batch", handlers.OptionalJWTMiddleware(handlers.ReactionBatchHandler(db))).Methods("POST")
+
+	router.Handle("/api/attachments", handlers.JWTMiddleware(handlers.UploadAttachmentHandler(db, store))).Methods("POST")
+	router.HandleFunc("/api/attachments/{id}", handlers.GetAttachmentHandler(db, store)).Methods("GET")
+	router.Handle("/api/attachments/{id}", handlers.JWTMiddleware(handlers.DeleteAttachmentHandler(db, store))).Methods("DELETE")
+	router.HandleFunc("/api/threads/{id}/attachments", handlers.GetThreadAttachmentsHandler(db)).Methods("GET")
+
+	router.Handle("/api/drafts", handlers.JWTMiddleware(handlers.GetDraftsHandler(db))).Methods("GET")
+	router.Handle("/api/drafts", handlers.JWTMiddleware(handlers.CreateDraftHandler(db))).Methods("POST")
+	router.Handle("/api/drafts/{id}", handlers.JWTMiddleware(handlers.UpdateDraftHandler(db))).Methods("PUT")
+	router.Handle("/api/drafts/{id}", handlers.JWTMiddleware(handlers.DeleteDraftHandler(db))).Methods("DELETE")
+	router.Handle("/api/drafts/{id}/publish", handlers.JWTMiddleware(handlers.PublishDraftHandler(db))).Methods("POST")
 
-	router.HandleFunc("/api/user/{user}/comments", handlers.GetCommentsByUserHandler(db)).Methods("GET")
-	router.HandleFunc("/api/user/{user}/threads", handlers.GetThreadsByUserHandler(db)).Methods("GET")
+	router.Handle("/api/notifications", handlers.JWTMiddleware(handlers.GetNotificationsHandler(db))).Methods("GET")
+	router.Handle("/api/notifications/unread-count", handlers.JWTMiddleware(handlers.GetUnreadNotificationCountHandler(db))).Methods("GET")
+	router.Handle("/api/notifications/read-all", handlers.JWTMiddleware(handlers.MarkAllNotificationsReadHandler(db))).Methods("POST")
+	router.Handle("/api/notifications/{id}/read", handlers.JWTMiddleware(handlers.MarkNotificationReadHandler(db))).Methods("POST")
 
-	router.HandleFunc("/api/categories", handlers.GetAllCategoriesHandler(db)).Methods("GET")
+	router.Handle("/api/threads/{id}/merge", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.MergeThreadHandler(db)))).Methods("POST")
+	router.Handle("/api/threads/{id}/split", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.SplitThreadHandler(db)))).Methods("POST")
+	router.Handle("/api/threads/{id}/move", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.MoveThreadHandler(db)))).Methods("POST")
+	router.Handle("/api/comments/{id}/remove", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.RemoveCommentHandler(db, store)))).Methods("POST")
+	router.Handle("/api/moderation/log", handlers.JWTMiddleware(handlers.ModeratorMiddleware(db, handlers.GetModerationLogHandler(db)))).Methods("GET")
 
 	router.Handle("/api/report", handlers.JWTMiddleware(handlers.CreateReportHandler(db))).Methods("POST")
 
@@ -0,0 +1,171 @@
+package similarity
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Common English words that say nothing about the topic of a text
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"but": true, "by": true, "can": true, "do": true, "does": true, "for": true, "from": true,
+	"has": true, "have": true, "how": true, "i": true, "if": true, "in": true, "is": true,
+	"it": true, "its": true, "me": true, "my": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "so": true, "that": true, "the": true, "this": true, "to": true,
+	"was": true, "we": true, "what": true, "when": true, "where": true, "which": true,
+	"who": true, "why": true, "will": true, "with": true, "you": true, "your": true,
+}
+
+// Tokenize splits text into lower case words, dropping stop words and single
+// characters
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := fields[:0]
+	for _, field := range fields {
+		if len([]rune(field)) > 1 && !stopWords[field] {
+			tokens = append(tokens, field)
+		}
+	}
+	return tokens
+}
+
+// Document is a text to be indexed. The title counts twice as much as the body.
+type Document struct {
+	ID       int
+	Title    string
+	Body     string
+	Category string
+}
+
+type Match struct {
+	ID    int
+	Score float64
+}
+
+// Index ranks documents by the cosine similarity of their TF-IDF vectors, with
+// a small bonus for documents in the same category. It is immutable once built
+// and safe for concurrent use.
+type Index struct {
+	vectors    map[int]map[string]float64
+	categories map[int]string
+	df         map[string]int
+	size       int
+}
+
+// CategoryBonus is added to the score of documents sharing a category
+const CategoryBonus = 0.1
+
+func terms(title, body string) map[string]float64 {
+	tf := make(map[string]float64)
+	for _, token := range Tokenize(title) {
+		tf[token] += 2
+	}
+	for _, token := range Tokenize(body) {
+		tf[token]++
+	}
+	return tf
+}
+
+func NewIndex(docs []Document) *Index {
+	index := &Index{
+		vectors:    make(map[int]map[string]float64, len(docs)),
+		categories: make(map[int]string, len(docs)),
+		df:         make(map[string]int),
+		size:       len(docs),
+	}
+
+	tfs := make(map[int]map[string]float64, len(docs))
+	for _, doc := range docs {
+		tf := terms(doc.Title, doc.Body)
+		for term := range tf {
+			index.df[term]++
+		}
+		tfs[doc.ID] = tf
+		index.categories[doc.ID] = doc.Category
+	}
+
+	for id, tf := range tfs {
+		index.vectors[id] = index.weigh(tf)
+	}
+	return index
+}
+
+// weigh turns term frequencies into a unit length TF-IDF vector
+func (index *Index) weigh(tf map[string]float64) map[string]float64 {
+	vector := make(map[string]float64, len(tf))
+	var norm float64
+	for term, count := range tf {
+		// Smoothed IDF so terms unknown to the index still count
+		idf := math.Log(float64(index.size+1)/float64(index.df[term]+1)) + 1
+		weight := (1 + math.Log(count)) * idf
+		vector[term] = weight
+		norm += weight * weight
+	}
+
+	norm = math.Sqrt(norm)
+	for term := range vector {
+		vector[term] /= norm
+	}
+	return vector
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var dot float64
+	for term, weight := range a {
+		dot += weight * b[term]
+	}
+	return dot
+}
+
+func (index *Index) rank(vector map[string]float64, category string, exclude int, limit int, minScore float64) []Match {
+	var matches []Match
+	for id, other := range index.vectors {
+		if id == exclude {
+			continue
+		}
+		score := cosine(vector, other)
+		if score == 0 {
+			continue
+		}
+		if category != "" && index.categories[id] == category {
+			score += CategoryBonus
+		}
+		if score >= minScore {
+			matches = append(matches, Match{ID: id, Score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID > matches[j].ID
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// Related returns the documents most similar to an indexed document
+func (index *Index) Related(id int, limit int) []Match {
+	vector, ok := index.vectors[id]
+	if !ok {
+		return nil
+	}
+	return index.rank(vector, index.categories[id], id, limit, 0)
+}
+
+// Similar returns the indexed documents most similar to a text that is not in
+// the index, scoring at least minScore
+func (index *Index) Similar(title, body, category string, limit int, minScore float64) []Match {
+	return index.rank(index.weigh(terms(title, body)), category, 0, limit, minScore)
+}
@@ -0,0 +1,115 @@
+package similarity
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"How do I install Go?", []string{"install", "go"}},
+		{"MySQL 8.0 won't start", []string{"mysql", "won", "start"}},
+		{"a b c x", []string{}},
+		{"Übergröße café-bar", []string{"übergröße", "café", "bar"}},
+		{"the THE The", []string{}},
+		{"snake_case and kebab-case", []string{"snake", "case", "kebab", "case"}},
+	}
+	for _, tt := range tests {
+		got := Tokenize(tt.text)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+var testDocs = []Document{
+	{ID: 1, Title: "How to install Go on Ubuntu", Body: "Installing the Go toolchain on Ubuntu 22.04 with apt fails.", Category: "Help"},
+	{ID: 2, Title: "Installing Go on Debian", Body: "The Go toolchain from apt on Debian is outdated.", Category: "Help"},
+	{ID: 3, Title: "Best pizza toppings", Body: "Pineapple on pizza, yes or no?", Category: "Off topic"},
+	{ID: 4, Title: "Ubuntu desktop freezes", Body: "My Ubuntu desktop freezes after waking from sleep.", Category: "Help"},
+	{ID: 5, Title: "Go generics tutorial", Body: "A walk through type parameters in Go.", Category: "Guides"},
+}
+
+func TestVectorsAreUnitLength(t *testing.T) {
+	index := NewIndex(testDocs)
+	for id, vector := range index.vectors {
+		var norm float64
+		for _, weight := range vector {
+			norm += weight * weight
+		}
+		if math.Abs(norm-1) > 1e-9 {
+			t.Errorf("vector of %d has squared norm %f, want 1", id, norm)
+		}
+	}
+}
+
+func TestRelatedOrder(t *testing.T) {
+	index := NewIndex(testDocs)
+
+	matches := index.Related(1, 10)
+	if len(matches) == 0 || matches[0].ID != 2 {
+		t.Fatalf("Related(1) = %v, want thread 2 first", matches)
+	}
+	for i := 1; i < len(matches); i++ {
+		if matches[i].Score > matches[i-1].Score {
+			t.Errorf("Related(1) is not sorted by score: %v", matches)
+		}
+	}
+	for _, match := range matches {
+		if match.ID == 1 {
+			t.Errorf("Related(1) includes the thread itself")
+		}
+		if match.ID == 3 {
+			t.Errorf("Related(1) includes thread 3 which shares no terms")
+		}
+	}
+
+	if got := index.Related(1, 1); len(got) != 1 {
+		t.Errorf("Related(1, 1) returned %d matches", len(got))
+	}
+	if got := index.Related(42, 10); got != nil {
+		t.Errorf("Related of an unknown thread = %v, want nil", got)
+	}
+}
+
+func TestCategoryBonus(t *testing.T) {
+	index := NewIndex(testDocs)
+
+	without := index.Similar("Go on Ubuntu", "", "", 10, 0)
+	with := index.Similar("Go on Ubuntu", "", "Help", 10, 0)
+	scores := make(map[int]float64)
+	for _, match := range without {
+		scores[match.ID] = match.Score
+	}
+	for _, match := range with {
+		want := scores[match.ID]
+		if testDocs[match.ID-1].Category == "Help" {
+			want += CategoryBonus
+		}
+		if math.Abs(match.Score-want) > 1e-9 {
+			t.Errorf("score of %d in Help = %f, want %f", match.ID, match.Score, want)
+		}
+	}
+}
+
+func TestSimilarMinScore(t *testing.T) {
+	index := NewIndex(testDocs)
+
+	// The same text as an indexed document scores 1 against it
+	matches := index.Similar(testDocs[2].Title, testDocs[2].Body, "", 10, 0.99)
+	if len(matches) != 1 || matches[0].ID != 3 || math.Abs(matches[0].Score-1) > 1e-9 {
+		t.Errorf("Similar of an indexed text = %v, want thread 3 with score 1", matches)
+	}
+
+	if matches := index.Similar("Completely unrelated words", "", "", 10, 0.01); len(matches) != 0 {
+		t.Errorf("Similar of unrelated text = %v, want none", matches)
+	}
+}
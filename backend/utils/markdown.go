@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"bytes"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// goldmark already leaves out raw HTML, the sanitizer removes unsafe URLs and
+// attributes that get through anyway and adds rel="nofollow" to links
+var sanitizer = bluemonday.UGCPolicy()
+
+// RenderMarkdown converts user written Markdown into sanitised HTML that is safe
+// to insert into a page as is
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return sanitizer.Sanitize(buf.String()), nil
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		banned []string
+	}{
+		{"script tag", "hi <script>alert(1)</script>", []string{"<script"}},
+		{"javascript link", "[click](javascript:alert(1))", []string{"href"}},
+		{"javascript autolink", "<javascript:alert(1)>", []string{"href"}},
+		{"onerror attribute", `<img src="x" onerror="alert(1)">`, []string{"onerror", "<img"}},
+		{"raw HTML", `<div style="position:fixed">overlay</div> <iframe src="https://example.com"></iframe>`, []string{"<div", "<iframe", "style="}},
+		{"image onerror in Markdown", `![x](https://example.com/a.png "t\" onerror=\"alert(1)")`, []string{"onerror="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := RenderMarkdown(tt.source)
+			if err != nil {
+				t.Fatalf("RenderMarkdown failed: %v", err)
+			}
+			for _, banned := range tt.banned {
+				if strings.Contains(html, banned) {
+					t.Errorf("RenderMarkdown(%q) = %q, contains %q", tt.source, html, banned)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	html, err := RenderMarkdown("see [the docs](https://example.com/docs)")
+	if err != nil {
+		t.Fatalf("RenderMarkdown failed: %v", err)
+	}
+	if !strings.Contains(html, `href="https://example.com/docs"`) || !strings.Contains(html, `rel="nofollow"`) {
+		t.Errorf("link rendered as %q, want the href with rel=\"nofollow\"", html)
+	}
+}
+
+func TestRenderMarkdownFormatting(t *testing.T) {
+	html, err := RenderMarkdown("**bold** and `code`\n\n- item")
+	if err != nil {
+		t.Fatalf("RenderMarkdown failed: %v", err)
+	}
+	for _, want := range []string{"<strong>bold</strong>", "<code>code</code>", "<li>item</li>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("RenderMarkdown = %q, want it to contain %q", html, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Mention is an @username found in a post. Start and End are offsets in UTF-16
+// code units, the unit JavaScript strings are indexed in, and span the whole
+// mention including the @.
+type Mention struct {
+	Username string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+func isUsernameChar(r rune) bool {
+	return r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// ParseMentions finds the @username mentions in Markdown text. An @ only
+// starts a mention at the beginning of a word, so email addresses are not
+// mentions, and mentions in code spans and code blocks are ignored. The names
+// follow the rules of ValidateUsername but are not checked against any users.
+func ParseMentions(text string) []Mention {
+	runes := []rune(text)
+	var mentions []Mention
+
+	offset := 0 // UTF-16 offset of runes[i]
+	codeFence := 0
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		// A code span or block ends at a run of as many backticks as opened it
+		if r == '`' {
+			run := 1
+			for i+run < len(runes) && runes[i+run] == '`' {
+				run++
+			}
+			if codeFence == 0 {
+				codeFence = run
+			} else if codeFence == run {
+				codeFence = 0
+			}
+			i += run
+			offset += run
+			continue
+		}
+
+		if r == '@' && codeFence == 0 && (i == 0 || !isUsernameChar(runes[i-1]) && runes[i-1] != '@') {
+			end := i + 1
+			for end < len(runes) && isUsernameChar(runes[end]) {
+				end++
+			}
+			// A name running into other letters is not a mention of a shorter name
+			wordEnd := end == len(runes) || !unicode.IsLetter(runes[end]) && !unicode.IsDigit(runes[end])
+			if name := string(runes[i+1 : end]); wordEnd && ValidateUsername(name) == nil {
+				// Every rune of the mention is ASCII, one UTF-16 unit each
+				mentions = append(mentions, Mention{Username: name, Start: offset, End: offset + end - i})
+				offset += end - i
+				i = end
+				continue
+			}
+		}
+
+		offset += utf16.RuneLen(r)
+		i++
+	}
+	return mentions
+}
+
+// MentionedUsernames returns the distinct usernames mentioned in text, in the
+// order they first appear. Usernames are compared case insensitively.
+func MentionedUsernames(text string) []string {
+	seen := make(map[string]bool)
+	var usernames []string
+	for _, mention := range ParseMentions(text) {
+		key := strings.ToLower(mention.Username)
+		if !seen[key] {
+			seen[key] = true
+			usernames = append(usernames, mention.Username)
+		}
+	}
+	return usernames
+}
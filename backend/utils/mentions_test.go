@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Mention
+	}{
+		{"none", "no mentions here", nil},
+		{"start of text", "@alice hi", []Mention{{"alice", 0, 6}}},
+		{"several", "thanks @bob and @carol_2!", []Mention{{"bob", 7, 11}, {"carol_2", 16, 24}}},
+		{"email address", "mail me at bob@example.com", nil},
+		{"double @", "@@alice", nil},
+		{"too short", "@al is not a user", nil},
+		{"too long is cut", "@abcdefghijklmnopqrstu", nil},
+		{"punctuation ends the name", "(@alice), @bob.", []Mention{{"alice", 1, 7}, {"bob", 10, 14}}},
+		{"non ASCII letters end the name", "@alicé", nil},
+		{"code span", "`@alice` and @bob", []Mention{{"bob", 13, 17}}},
+		{"double backtick span", "``a ` @alice`` @bob", []Mention{{"bob", 15, 19}}},
+		{"code block", "```\n@alice\n```\n@bob", []Mention{{"bob", 15, 19}}},
+		{"after astral character", "😀 @alice", []Mention{{"alice", 3, 9}}},
+		{"after BMP character", "é @alice", []Mention{{"alice", 2, 8}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMentions(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMentionOffsetsSliceMention(t *testing.T) {
+	text := "👋 héllo @alice, see `@x` and 日本 @bob_99"
+	for _, mention := range ParseMentions(text) {
+		got, ok := UTF16Slice(text, mention.Start, mention.End)
+		if !ok || got != "@"+mention.Username {
+			t.Errorf("UTF16Slice at %d-%d = %q, %t, want %q", mention.Start, mention.End, got, ok, "@"+mention.Username)
+		}
+	}
+}
+
+func TestMentionedUsernames(t *testing.T) {
+	got := MentionedUsernames("@Alice @bob @alice @BOB @carol")
+	want := []string{"Alice", "bob", "carol"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MentionedUsernames = %q, want %q", got, want)
+	}
+	if got := MentionedUsernames("nobody"); got != nil {
+		t.Errorf("MentionedUsernames without mentions = %q, want nil", got)
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugs are cut at a word boundary once they reach this many runes
+const maxSlugLength = 80
+
+var lower = cases.Lower(language.Und)
+
+// Slugify turns a title into a lower case, hyphen separated URL slug.
+// Accents are removed from Latin letters ("Café" becomes "cafe") while other
+// scripts are kept as they are, so a title in any language gives a readable
+// slug. Returns "" if the title has no letters or digits.
+func Slugify(title string) string {
+	var b strings.Builder
+	latinBase := false
+	hyphen := false
+	// Decompose so accents become separate marks that can be dropped
+	for _, r := range norm.NFD.String(lower.String(title)) {
+		switch {
+		case unicode.IsMark(r):
+			// Marks are part of the letter in scripts like Devanagari
+			if !latinBase && b.Len() > 0 && !hyphen {
+				b.WriteRune(r)
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if hyphen {
+				b.WriteByte('-')
+				hyphen = false
+			}
+			b.WriteRune(r)
+			latinBase = unicode.Is(unicode.Latin, r)
+		default:
+			hyphen = b.Len() > 0
+			latinBase = false
+		}
+	}
+
+	slug := norm.NFC.String(b.String())
+	if runes := []rune(slug); len(runes) > maxSlugLength {
+		slug = string(runes[:maxSlugLength])
+		if i := strings.LastIndexByte(slug, '-'); i > 0 {
+			slug = slug[:i]
+		}
+	}
+	return slug
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Leading and trailing  ", "leading-and-trailing"},
+		{"Go 1.23 released", "go-1-23-released"},
+		{"Café crème brûlée", "cafe-creme-brulee"},
+		{"ÀÉÎÕÜ", "aeiou"},
+		{"Straße", "straße"},
+		{"Привет мир", "привет-мир"},
+		{"日本語のタイトル", "日本語のタイトル"},
+		{"नमस्ते दुनिया", "नमस्ते-दुनिया"},
+		{"C++ vs. C#", "c-vs-c"},
+		{"!!!", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.title); got != tt.want {
+			t.Errorf("Slugify(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSlugifyLength(t *testing.T) {
+	title := strings.Repeat("word ", 40)
+	slug := Slugify(title)
+	if n := utf8.RuneCountInString(slug); n > maxSlugLength {
+		t.Errorf("slug has %d runes, want at most %d", n, maxSlugLength)
+	}
+	if strings.HasSuffix(slug, "-") || !strings.HasSuffix(slug, "word") {
+		t.Errorf("slug %q is not cut at a word boundary", slug)
+	}
+
+	// A single long word is cut where it is
+	long := strings.Repeat("é", 100)
+	if got := Slugify(long); got != strings.Repeat("e", maxSlugLength) {
+		t.Errorf("Slugify of a long word = %q", got)
+	}
+}
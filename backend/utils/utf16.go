@@ -0,0 +1,33 @@
+package utils
+
+import "unicode/utf16"
+
+// UTF16Slice returns the part of text from start to end, counted in UTF-16
+// code units like the offsets of Mention. ok is false if the range is empty,
+// out of bounds or splits a character.
+func UTF16Slice(text string, start, end int) (slice string, ok bool) {
+	if start < 0 || end <= start {
+		return "", false
+	}
+
+	startByte, endByte := -1, -1
+	offset := 0
+	for i, r := range text {
+		if offset == start {
+			startByte = i
+		}
+		if offset == end {
+			endByte = i
+			break
+		}
+		offset += utf16.RuneLen(r)
+	}
+	if offset == end && endByte < 0 {
+		endByte = len(text)
+	}
+
+	if startByte < 0 || endByte < 0 {
+		return "", false
+	}
+	return text[startByte:endByte], true
+}
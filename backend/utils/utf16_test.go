@@ -0,0 +1,35 @@
+package utils
+
+import "testing"
+
+func TestUTF16Slice(t *testing.T) {
+	tests := []struct {
+		text       string
+		start, end int
+		want       string
+		ok         bool
+	}{
+		{"hello world", 0, 5, "hello", true},
+		{"hello world", 6, 11, "world", true},
+		{"hello", 0, 5, "hello", true},
+		{"héllo", 1, 3, "él", true},
+		{"日本語", 1, 2, "本", true},
+		// 😀 is a surrogate pair, two code units
+		{"a😀b", 1, 3, "😀", true},
+		{"a😀b", 3, 4, "b", true},
+		{"a😀b", 1, 2, "", false},
+		{"a😀b", 2, 4, "", false},
+		{"hello", 2, 2, "", false},
+		{"hello", 3, 2, "", false},
+		{"hello", -1, 2, "", false},
+		{"hello", 2, 6, "", false},
+		{"hello", 5, 6, "", false},
+		{"", 0, 1, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := UTF16Slice(tt.text, tt.start, tt.end)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("UTF16Slice(%q, %d, %d) = %q, %t, want %q, %t", tt.text, tt.start, tt.end, got, ok, tt.want, tt.ok)
+		}
+	}
+}